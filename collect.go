@@ -0,0 +1,38 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"rmq-console-exporter/pkg/exporters"
+)
+
+// Runs all the collectors once and writes the metrics to the output file or stdout. The metrics collected are
+// written even when a collector fails, but the exit status is not 0 so cron or CI can detect it.
+func collectMetrics(prefix string, rmqCollectors []exporters.ICollector, metricLabels []string, format string,
+	output string) int {
+	exporter := exporters.NewPrometheusExporterWithLabels(prefix, 0, rmqCollectors, metricLabels)
+	families, collectErr := exporter.Gather()
+	if collectErr != nil {
+		log.Errorf("collection failed: %v", collectErr)
+	}
+
+	var writer io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			log.Error(err)
+			return 1
+		}
+		defer file.Close()
+		writer = file
+	}
+	if err := exporters.WriteMetrics(writer, families, format); err != nil {
+		log.Error(err)
+		return 1
+	}
+	if collectErr != nil {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"rmq-console-exporter/pkg/collectors"
+	"rmq-console-exporter/pkg/exporters"
+	"testing"
+)
+
+func fileCollector(t *testing.T, path string) exporters.ICollector {
+	config, err := collectors.NewConfig("")
+	assert.Nil(t, err)
+	parser := collectors.NewQueueTableParser(config)
+	return collectors.NewCmdCollector(parser, collectors.NewFileExecutorFactory(path), 1000, 100)
+}
+
+func TestCollectMetrics(t *testing.T) {
+	rmqCollectors := []exporters.ICollector{fileCollector(t, writeTestFile(t, "list_queues.txt", testListQueues))}
+	output, status := captureStdout(t, func() int {
+		return collectMetrics("test_", rmqCollectors, exporters.QueueMetricLabels, exporters.OutputProm, "")
+	})
+	assert.Equal(t, 0, status)
+	assert.Contains(t, output, `test_messages_ready{queue="orders",state="running"} 3`)
+
+	path := filepath.Join(t.TempDir(), "queues.csv")
+	output, status = captureStdout(t, func() int {
+		return collectMetrics("test_", rmqCollectors, exporters.QueueMetricLabels, exporters.OutputCSV, path)
+	})
+	assert.Equal(t, 0, status)
+	assert.Empty(t, output)
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "test_messages_ready,orders,running,3")
+}
+
+// The metrics of the other collectors are written but the exit status is 1
+func TestCollectMetricsFailing(t *testing.T) {
+	rmqCollectors := []exporters.ICollector{
+		fileCollector(t, writeTestFile(t, "list_queues.txt", testListQueues)),
+		fileCollector(t, filepath.Join(t.TempDir(), "missing.txt")),
+	}
+	output, status := captureStdout(t, func() int {
+		return collectMetrics("test_", rmqCollectors, exporters.QueueMetricLabels, exporters.OutputProm, "")
+	})
+	assert.Equal(t, 1, status)
+	assert.Contains(t, output, `test_messages_ready{queue="billing",state="running"} 5`)
+
+	_, status = captureStdout(t, func() int {
+		return collectMetrics("test_", rmqCollectors[:1], exporters.QueueMetricLabels, "xml", "")
+	})
+	assert.Equal(t, 1, status)
+	assert.Equal(t, 1, collectMetrics("test_", rmqCollectors[:1], exporters.QueueMetricLabels, exporters.OutputProm, t.TempDir()))
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"rmq-console-exporter/pkg/collectors"
+	"rmq-console-exporter/pkg/exporters"
+	"strings"
+)
+
+// rmq-console-exporter config check [flags] [file]
+// Validates the config file (default -config_file) with the environment variables and flags, and prints the
+// effective settings of the exporter with where they come from
+func runConfig(arguments []string) int {
+	usage := func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s config check [flags] [file]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.CommandLine.Usage = usage
+	if len(arguments) == 0 || arguments[0] != "check" {
+		usage()
+		return 2
+	}
+	_ = flag.CommandLine.Parse(arguments[1:])
+
+	var errs []string
+	sources := make(map[string]string)
+	setFlags := collectors.SetFlagNames(flag.CommandLine)
+	for name := range setFlags {
+		sources[name] = "flag"
+	}
+	if err := collectors.SetFlagsFromEnv(flag.CommandLine, setFlags); err != nil {
+		errs = append(errs, fmt.Sprintf("environment variables: %v", err))
+	}
+	for name := range setFlags {
+		if sources[name] == "" {
+			sources[name] = "env " + collectors.EnvPrefix + strings.ToUpper(name)
+		}
+	}
+
+	path := flag.Arg(0)
+	if path == "" {
+		path = flag.Lookup("config_file").Value.String()
+	}
+	if path == "" {
+		fmt.Fprintln(os.Stderr, "no config file, use -config_file, RMQ_EXPORTER_CONFIG_FILE or pass the file")
+		return 2
+	}
+	log.SetLevel(log.WarnLevel)
+	config, err := collectors.NewConfig(path)
+	if err != nil {
+		errs = append(errs, err.Error())
+	} else {
+		errs = append(errs, checkConfig(config.Snapshot(), setFlags, sources)...)
+	}
+
+	if len(errs) > 0 {
+		fmt.Printf("%s: INVALID\n", path)
+		for _, e := range errs {
+			fmt.Printf("  - %s\n", e)
+		}
+		return 1
+	}
+	fmt.Printf("%s: OK\n", path)
+	flag.VisitAll(func(f *flag.Flag) {
+		source := sources[f.Name]
+		if source == "" {
+			source = "default"
+		}
+		fmt.Printf("  %s = %q (%s)\n", f.Name, f.Value.String(), source)
+	})
+	return 0
+}
+
+// The checks of the startup that do not need RabbitMQ
+func checkConfig(config *collectors.ConfigSnapshot, setFlags map[string]bool, sources map[string]string) []string {
+	var errs []string
+	if err := config.SetFlags(flag.CommandLine, setFlags); err != nil {
+		errs = append(errs, err.Error())
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if sources[f.Name] == "" {
+			sources[f.Name] = "config file [" + collectors.ExporterTable + "]"
+		}
+	})
+	checkChoice := func(name string, choices ...string) {
+		value := flag.Lookup(name).Value.String()
+		for _, choice := range choices {
+			if value == choice { return }
+		}
+		errs = append(errs, fmt.Sprintf("%s: invalid value %q, expected one of %s", name, value, strings.Join(choices, ", ")))
+	}
+	checkChoice("queue_parser", "auto", "json", "tabular", "tabular_header", "erlang", "erlang_eval")
+	checkChoice("source", "cli", "management")
+	checkChoice("format", exporters.OutputProm, exporters.OutputJSON, exporters.OutputCSV, exporters.OutputInflux)
+	if _, err := log.ParseLevel(flag.Lookup("log_level").Value.String()); err != nil {
+		errs = append(errs, fmt.Sprintf("log_level: %v", err))
+	}
+	if err := config.GetCtlOptions().Validate(); err != nil {
+		errs = append(errs, fmt.Sprintf("rabbitmqctl: %v", err))
+	}
+	// Same constructors as the startup, which stops on their errors
+	if _, err := collectors.NewExecutorFactoryFromOptions(config.GetExecutorOptions()); err != nil {
+		errs = append(errs, fmt.Sprintf("executor: %v", err))
+	}
+	if flag.Lookup("source").Value.String() == "management" {
+		if _, err := collectors.NewManagementClient(config.GetManagementOptions()); err != nil {
+			errs = append(errs, fmt.Sprintf("management: %v", err))
+		}
+	}
+	if alertOptions, err := config.GetAlertOptions(); err == nil && len(alertOptions.Rules) > 0 {
+		if _, err := exporters.NewAlertEvaluator(alertOptions); err != nil {
+			errs = append(errs, fmt.Sprintf("alerting: %v", err))
+		}
+	}
+	if otlpOptions := config.GetOTLPOptions(); otlpOptions.Endpoint != "" {
+		if _, err := exporters.NewOTLPExporter(otlpOptions); err != nil {
+			errs = append(errs, fmt.Sprintf("otlp: %v", err))
+		}
+	}
+	if dogStatsDOptions := config.GetDogStatsDOptions(flag.Lookup("prefix").Value.String()); dogStatsDOptions.Address != "" {
+		if _, err := exporters.NewDogStatsDSender(dogStatsDOptions); err != nil {
+			errs = append(errs, fmt.Sprintf("dogstatsd: %v", err))
+		}
+	}
+	if _, err := exporters.NewInfluxDBWriter(config.GetInfluxDBOptions()); err != nil {
+		errs = append(errs, fmt.Sprintf("influxdb: %v", err))
+	}
+	return errs
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"rmq-console-exporter/pkg/exporters"
+	"testing"
+)
+
+// Flags of the exporter read by the config checks, main defines them on flag.CommandLine
+func resetTestFlags() {
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	flag.Int("port", 2112, "")
+	flag.String("prefix", "rmq_", "")
+	flag.String("log_level", "info", "")
+	flag.String("queue_parser", "json", "")
+	flag.String("source", "cli", "")
+	flag.String("config_file", "", "")
+	flag.String("format", exporters.OutputProm, "")
+	flag.String("erlang_cookie", "", "")
+}
+
+func checkTestConfig(t *testing.T, content string, arguments ...string) (string, int) {
+	resetTestFlags()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return captureStdout(t, func() int {
+		return runConfig(append(append([]string{"check"}, arguments...), path))
+	})
+}
+
+func TestConfigCheckOk(t *testing.T) {
+	assert.Nil(t, os.Setenv("RMQ_EXPORTER_LOG_LEVEL", "debug"))
+	defer os.Unsetenv("RMQ_EXPORTER_LOG_LEVEL")
+	output, status := checkTestConfig(t, "[exporter]\nport = 2113\n[filters]\nqueues = ['^orders']\n", "-prefix", "test_")
+
+	assert.Equal(t, 0, status)
+	assert.Contains(t, output, "config.toml: OK\n")
+	assert.Contains(t, output, `port = "2113" (config file [exporter])`)
+	assert.Contains(t, output, `prefix = "test_" (flag)`)
+	assert.Contains(t, output, `log_level = "debug" (env RMQ_EXPORTER_LOG_LEVEL)`)
+	assert.Contains(t, output, `queue_parser = "json" (default)`)
+}
+
+// The options that stop the exporter at startup make the check fail
+func TestConfigCheckInvalid(t *testing.T) {
+	for content, expected := range map[string]string{
+		"[exporter]\nqueue_parser = 'xml'\n": `queue_parser: invalid value "xml"`,
+		"[executor]\ntype = 'bogus'\n": `executor: unknown executor "bogus"`,
+		"[executor]\ntype = 'docker'\n": "executor: the container is required by the docker executor",
+		"[otlp]\nendpoint = 'http://localhost:4317'\nprotocol = 'grpc'\n": "otlp: OTLP over gRPC requires TLS",
+		"[dogstatsd]\naddress = 'localhost'\n": `dogstatsd: invalid DogStatsD address "localhost"`,
+		"[influxdb]\nurl = 'http://localhost:8086'\nstdout = true\n": "influxdb: the InfluxDB url and stdout can't be both set",
+		"[exporter]\nsource = 'management'\n": "management: the url of the management API is required",
+	} {
+		output, status := checkTestConfig(t, content)
+		assert.Equal(t, 1, status, content)
+		assert.Contains(t, output, "config.toml: INVALID\n", content)
+		assert.Contains(t, output, expected, content)
+	}
+}
+
+func TestConfigCheckUsage(t *testing.T) {
+	resetTestFlags()
+	flag.CommandLine.SetOutput(ioutil.Discard)
+	assert.Equal(t, 2, runConfig(nil))
+	assert.Equal(t, 2, runConfig([]string{"validate"}))
+	// No config file
+	assert.Equal(t, 2, runConfig([]string{"check"}))
+
+	_, status := captureStdout(t, func() int {
+		return runConfig([]string{"check", filepath.Join(t.TempDir(), "missing.toml")})
+	})
+	assert.Equal(t, 1, status)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	log "github.com/sirupsen/logrus"
+	"os"
+	utils "rmq-console-exporter/pkg/internalutils"
+	"strings"
+	"time"
+)
+
+// Flags of -create_config, they are not written to the [exporter] table of the config
+var createConfigFlags = map[string]bool{
+	"create_config": true,
+	"config_file": true,
+	"non_interactive": true,
+	"queue_regex": true,
+	"sample_queues": true,
+	"overwrite": true,
+}
+
+// Flag that can be repeated, e.g. -queue_regex '^a' -queue_regex '^b'
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// Without -non_interactive nor -queue_regex the wizard asks for the path and the regexps, otherwise the config is
+// written to -config_file with the regexps of -queue_regex (or stdin) and configFileFlags in the [exporter] table
+func createConfigFile(nonInteractive bool, configFilePath string, queueRegexps []string, sampleQueuesPath string,
+	overwrite bool, configFileFlags []string) int {
+	if !nonInteractive && len(queueRegexps) == 0 {
+		if err := utils.CreateConfig(); err != nil {
+			log.Error(err)
+			return 1
+		}
+		return 0
+	}
+
+	options := utils.ConfigOptions{Path: configFilePath, QueueRegexps: queueRegexps, Overwrite: overwrite}
+	var err error
+	if len(options.QueueRegexps) == 0 {
+		if sampleQueuesPath == "-" {
+			log.Error("stdin can't be used for both the regexps and the sample queues, use -queue_regex")
+			return 2
+		}
+		if options.QueueRegexps, err = utils.ReadLines(os.Stdin); err != nil {
+			log.Error(err)
+			return 1
+		}
+	}
+	if sampleQueuesPath != "" {
+		if options.SampleQueues, err = readSampleQueues(sampleQueuesPath); err != nil {
+			log.Error(err)
+			return 1
+		}
+	}
+	options.Exporter = make(map[string]interface{})
+	for _, name := range configFileFlags {
+		if createConfigFlags[name] { continue }
+		options.Exporter[name] = configValue(flag.Lookup(name))
+	}
+
+	if err := utils.CreateConfigFromOptions(options, os.Stdout); err != nil {
+		log.Error(err)
+		return 1
+	}
+	return 0
+}
+
+func readSampleQueues(path string) ([]string, error) {
+	if path == "-" {
+		return utils.ReadLines(os.Stdin)
+	}
+	file, err := os.Open(path)
+	if err != nil { return nil, err }
+	defer file.Close()
+	return utils.ReadLines(file)
+}
+
+// TOML value of a flag, the durations are written as strings (e.g. "30s")
+func configValue(f *flag.Flag) interface{} {
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return f.Value.String()
+	}
+	if duration, ok := getter.Get().(time.Duration); ok {
+		return duration.String()
+	}
+	return getter.Get()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Replaces stdin with a file holding content until the test ends
+func setTestStdin(t *testing.T, content string) {
+	path := filepath.Join(t.TempDir(), "stdin")
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	file, err := os.Open(path)
+	assert.Nil(t, err)
+	stdin := os.Stdin
+	os.Stdin = file
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		file.Close()
+	})
+}
+
+func TestCreateConfigFileStdinTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.Equal(t, 2, createConfigFile(true, path, nil, "-", false, nil))
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCreateConfigFileExporterTable(t *testing.T) {
+	resetTestFlags()
+	flag.Bool("overwrite", false, "")
+	assert.Nil(t, flag.Set("port", "2113"))
+	assert.Nil(t, flag.Set("overwrite", "true"))
+	setTestStdin(t, "# regexps\n^orders\n\n^billing$\n")
+	path := filepath.Join(t.TempDir(), "config.toml")
+
+	output, status := captureStdout(t, func() int {
+		return createConfigFile(true, path, nil, "", true, []string{"overwrite", "port"})
+	})
+	assert.Equal(t, 0, status)
+	assert.Equal(t, "Config created: " + path + "\n", output)
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	// Only the flags of the exporter are written, not the ones of -create_config
+	assert.Contains(t, string(content), "[exporter]\n  port = 2113\n")
+	assert.NotContains(t, string(content), "overwrite")
+	assert.Contains(t, string(content), `queues = ["^orders", "^billing$"]`)
+}
+
+func TestCreateConfigFileSampleQueues(t *testing.T) {
+	resetTestFlags()
+	setTestStdin(t, "billing\naudit\n")
+	path := filepath.Join(t.TempDir(), "config.toml")
+
+	_, status := captureStdout(t, func() int {
+		return createConfigFile(true, path, []string{"^orders"}, "-", false, nil)
+	})
+	assert.Equal(t, 1, status)
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Equal(t, 1, createConfigFile(true, path, []string{"^orders"}, filepath.Join(t.TempDir(), "missing"), false, nil))
+}
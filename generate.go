@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"rmq-console-exporter/pkg/collectors"
+	"rmq-console-exporter/pkg/exporters"
+)
+
+// rmq-console-exporter generate [flags] rules|dashboard
+// Prints the recommended Prometheus alerting rules or the Grafana dashboard for the metrics exported with the prefix
+func runGenerate(arguments []string) int {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s generate [flags] rules|dashboard\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	prefix := flags.String("prefix", "rmq_", "Metrics prefix used by the exporter")
+	configFilePath := flags.String("config_file", "", "Config file of the exporter, for the prefix of its [exporter] table")
+	output := flags.String("output", "", "Output file (default stdout)")
+	_ = flags.Parse(arguments)
+	*prefix = generatePrefix(*prefix, collectors.SetFlagNames(flags)["prefix"], *configFilePath)
+
+	var content []byte
+	var err error
+	switch flags.Arg(0) {
+	case "rules":
+		content, err = exporters.GenerateRules(*prefix)
+	case "dashboard":
+		content, err = exporters.GenerateDashboard(*prefix)
+	default:
+		flags.Usage()
+		return 2
+	}
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(content)
+	} else {
+		err = ioutil.WriteFile(*output, content, 0644)
+	}
+	if err != nil {
+		log.Error(err)
+		return 1
+	}
+	return 0
+}
+
+// The prefix the exporter resolves: command line, environment variable, config file and default, in this order
+func generatePrefix(prefix string, commandLine bool, configFilePath string) string {
+	if commandLine {
+		return prefix
+	}
+	if value, ok := os.LookupEnv(collectors.EnvPrefix + "PREFIX"); ok {
+		return value
+	}
+	if configFilePath == "" {
+		return prefix
+	}
+	if value, ok := loadConfig(configFilePath).Snapshot().ExporterFlag("prefix"); ok {
+		return value
+	}
+	return prefix
+}
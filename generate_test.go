@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Same precedence as the exporter: command line, environment variable, config file and default
+func TestGeneratePrefix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("[exporter]\nport = 2113\nprefix = 'config_'\n"), 0644))
+
+	assert.Equal(t, "rmq_", generatePrefix("rmq_", false, ""))
+	assert.Equal(t, "config_", generatePrefix("rmq_", false, path))
+	assert.Equal(t, "cli_", generatePrefix("cli_", true, path))
+
+	assert.Nil(t, os.Setenv("RMQ_EXPORTER_PREFIX", "env_"))
+	defer os.Unsetenv("RMQ_EXPORTER_PREFIX")
+	assert.Equal(t, "env_", generatePrefix("rmq_", false, path))
+	assert.Equal(t, "cli_", generatePrefix("cli_", true, path))
+}
+
+func TestGenerateConfigPrefix(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.toml")
+	assert.Nil(t, ioutil.WriteFile(configPath, []byte("[exporter]\nprefix = 'config_'\n"), 0644))
+	output := filepath.Join(dir, "rules.yml")
+
+	assert.Equal(t, 0, runGenerate([]string{"-config_file", configPath, "-output", output, "rules"}))
+	content, err := ioutil.ReadFile(output)
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "config_messages_ready > 10000")
+	assert.NotContains(t, string(content), "rmq_")
+}
@@ -5,12 +5,17 @@ go 1.16
 require (
 	github.com/fsnotify/fsnotify v1.5.1
 	github.com/go-cmd/cmd v1.3.0
+	github.com/golang/snappy v0.0.3
 	github.com/manifoldco/promptui v0.9.0
 	github.com/oriser/regroup v0.0.0-20201024192559-010c434ff8f3
 	github.com/prometheus/client_golang v1.10.0
+	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.18.0
 	github.com/sirupsen/logrus v1.6.0
 	github.com/spf13/viper v1.9.0
 	github.com/stretchr/testify v1.7.0
-	github.com/tevino/abool v1.2.0
+	golang.org/x/crypto v0.0.0-20210817164053-32db794688a5
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -2,51 +2,269 @@ package main
 
 import (
 	"flag"
-	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
 	log "github.com/sirupsen/logrus"
+	"net/http"
 	"os"
 	"rmq-console-exporter/pkg/collectors"
 	"rmq-console-exporter/pkg/exporters"
-	utils "rmq-console-exporter/pkg/internalutils"
+	"strings"
+	"time"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "parse" {
+		os.Exit(runParse(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "generate" {
+		os.Exit(runGenerate(os.Args[2:]))
+	}
+	// rmq-console-exporter collect [flags] runs the collectors once with the same flags instead of serving HTTP
+	arguments := os.Args[1:]
+	collectOnce := len(arguments) > 0 && arguments[0] == "collect"
+	if collectOnce {
+		arguments = arguments[1:]
+	}
+
 	port := flag.Int("port", 2112, "Port to expose metrics")
 	prefix := flag.String("prefix", "rmq_", "Metrics prefix")
 	timeoutMs := flag.Int("timeout", 600000, "Timeout[Ms] for each collector")
 	outputBufferLines := flag.Int("output_buffer", 100000, "Output Buffer[lines]")
 	level := flag.String("log_level", "info", "Log Level: debug, info, error, etc")
-	qParser := flag.String("queue_parser", "json", "Queue Parser to use: json or tabular")
+	qParser := flag.String("queue_parser", "json", "Queue Parser to use: auto, json, tabular, tabular_header, erlang (3.7+) or erlang_eval (3.6)")
+	source := flag.String("source", "cli", "Source of the metrics: cli (rabbitmqctl) or management (HTTP API)")
 	configFilePath := flag.String("config_file", "", "Config file (use the flag -create_config to create one)")
 	createConfig := flag.Bool("create_config", false, "Lunch the tool to create a config file")
-	flag.Parse()
+	nonInteractive := flag.Bool("non_interactive", false, "Create the config file of -config_file without prompts, with the regexps of -queue_regex or stdin (one per line) and the other flags set")
+	var queueRegexps stringsFlag
+	flag.Var(&queueRegexps, "queue_regex", "Regexp of the queues to export in the config created by -create_config, can be repeated")
+	sampleQueues := flag.String("sample_queues", "", "File with queue names (one per line, - for stdin) to test the regexps of -create_config")
+	overwrite := flag.Bool("overwrite", false, "Overwrite the file of -create_config -non_interactive if it exists")
+	ctlPath := flag.String("rabbitmqctl", "", "Path to the rabbitmqctl binary (default rabbitmqctl from the PATH)")
+	node := flag.String("node", "", "RMQ node to collect from (-n)")
+	longNames := flag.Bool("longnames", false, "Use long node names (--longnames)")
+	erlangCookie := flag.String("erlang_cookie", "", "Erlang cookie to connect to the node (--erlang-cookie)")
+	ctlTimeout := flag.Int("rabbitmqctl_timeout", 0, "Timeout[s] of the rabbitmqctl commands (-t)")
+	quiet := flag.Bool("quiet", false, "Suppress informational messages of the rabbitmqctl commands (-q)")
+	ctlArguments := flag.String("rabbitmqctl_args", "", "Extra arguments for the rabbitmqctl commands")
+	startupChecks := flag.Bool("startup_checks", true, "Check at startup that rabbitmqctl exists and warn when the node doesn't respond")
+	format := flag.String("format", exporters.OutputProm, "Output format of the collect command: prom, json, csv or influx")
+	output := flag.String("output", "", "Output file of the collect command (default stdout)")
+	textfileDir := flag.String("textfile_dir", "", "Directory of the node_exporter textfile collector, the metrics are written there instead of exposed on the port")
+	pushInterval := flag.Duration("push_interval", time.Minute, "Interval to collect and push the metrics (textfile, pushgateway, remote_write, otlp, dogstatsd, influxdb)")
+	httpWithPush := flag.Bool("http_with_push", false, "Expose the metrics on the port also when they are pushed")
+	// rmq-console-exporter config check [file] validates the config file with the flags of the exporter
+	if len(arguments) > 0 && arguments[0] == "config" {
+		os.Exit(runConfig(arguments[1:]))
+	}
+	_ = flag.CommandLine.Parse(arguments)
+
+	// Command line, environment variables, config file and defaults, in this order
+	commandLineFlags := collectors.SetFlagNames(flag.CommandLine)
+	setFlags := collectors.SetFlagNames(flag.CommandLine)
+	if err := collectors.SetFlagsFromEnv(flag.CommandLine, setFlags); err != nil {
+		log.Fatalf("invalid environment variables: %v", err)
+	}
+	if *createConfig {
+		configFileFlags := collectors.ConfigFileFlagNames(setFlags, commandLineFlags)
+		os.Exit(createConfigFile(*nonInteractive, *configFilePath, queueRegexps, *sampleQueues, *overwrite, configFileFlags))
+	}
+	config := loadConfig(*configFilePath)
+	if err := config.Snapshot().SetFlags(flag.CommandLine, setFlags); err != nil {
+		log.Fatalf("invalid config file: %v", err)
+	}
 
 	configureLogLevel(*level)
 	log.Infof("Log Level set to %s", log.GetLevel().String())
-
-	if *createConfig {
-		err := utils.CreateConfig()
-		if err != nil {
-			log.Fatal(err)
+	log.Infof("Collector agent starting...")
+	// The management API collects the queues of all the vhosts, rabbitmqctl only the ones of a vhost
+	metricLabels := exporters.QueueMetricLabels
+	if *source == "management" {
+		metricLabels = exporters.VhostQueueMetricLabels
+	}
+	run := func(rmqCollectors []exporters.ICollector) {
+		if collectOnce {
+			os.Exit(collectMetrics(*prefix, rmqCollectors, metricLabels, *format, *output))
+		}
+		watchConfig(config, *prefix)
+		// The pushes and the scrapes share the exporter, so both update the snapshot of /api/v1/queues
+		exporter := exporters.NewPrometheusExporterWithLabels(*prefix, *port, rmqCollectors, metricLabels)
+		exporter.Alerts = loadAlerts(config.Snapshot())
+		pushers := loadPushers(config.Snapshot(), *prefix, *textfileDir, *node, rmqCollectors)
+		if len(pushers) > 0 && !*httpWithPush {
+			// No HTTP server, so no /-/reload: the config is reloaded on changes and SIGHUP only
+			runPushLoop(exporter, pushers, *pushInterval)
 		}
-		os.Exit(0)
+		if len(pushers) > 0 {
+			go runPushLoop(exporter, pushers, *pushInterval)
+		}
+		startExporter(exporter)
 	}
 
-	log.Infof("Collector agent starting...")
+	if *source == "management" {
+		run(managementCollectors(config, *timeoutMs, *startupChecks))
+		return
+	}
 
-	config := loadConfig(*configFilePath)
-	executorFactory := collectors.NewExecutorFactory()
+	executorOptions := config.Snapshot().GetExecutorOptions()
+	executorFactory, err := collectors.NewExecutorFactoryFromOptions(executorOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
 	queueParser := queueParserFactory(*qParser, config)
 	queueCollector := collectors.NewCmdCollector(queueParser, executorFactory, *timeoutMs, *outputBufferLines)
+	queueCollector.CookieProvider = config
+	queueCollector.CtlOptions = loadCtlOptions(config, func(ctlOptions *collectors.CtlOptions, f *flag.Flag) {
+		switch f.Name {
+		case "rabbitmqctl":
+			ctlOptions.Path = *ctlPath
+		case "node":
+			ctlOptions.Node = *node
+		case "longnames":
+			ctlOptions.LongNames = *longNames
+		case "erlang_cookie":
+			ctlOptions.ErlangCookie = *erlangCookie
+		case "rabbitmqctl_timeout":
+			ctlOptions.TimeoutSec = *ctlTimeout
+		case "quiet":
+			ctlOptions.Quiet = *quiet
+		case "rabbitmqctl_args":
+			ctlOptions.Arguments = strings.Fields(*ctlArguments)
+		}
+	})
+	if *startupChecks {
+		checkCollector(queueCollector, executorOptions)
+	}
+	// The auto parser detects the version at startup, it's retried by the first collection if the node is down
+	if err := queueCollector.UpdateVersion(); err != nil {
+		log.Warningf("RMQ version not detected: %v", err)
+	}
 
 	var rmqCollectors []exporters.ICollector
 	rmqCollectors = append(rmqCollectors, queueCollector)
-	exporter := exporters.NewPrometheusExporter(*prefix, *port, rmqCollectors)
+	run(rmqCollectors)
+}
+
+// The outputs that get the metrics pushed instead of scraped
+func loadPushers(config *collectors.ConfigSnapshot, prefix string, textfileDir string, node string, rmqCollectors []exporters.ICollector) []exporters.IPusher {
+	var pushers []exporters.IPusher
+	if textfileDir != "" {
+		pushers = append(pushers, exporters.NewTextfileWriter(textfileDir))
+	}
+	if pushgatewayOptions := config.GetPushgatewayOptions(); pushgatewayOptions.URL != "" {
+		pushers = append(pushers, exporters.NewPushgatewayPusher(pushgatewayOptions))
+	}
+	if remoteWriteOptions := config.GetRemoteWriteOptions(); remoteWriteOptions.URL != "" {
+		pushers = append(pushers, exporters.NewRemoteWriter(remoteWriteOptions))
+	}
+	if otlpOptions := config.GetOTLPOptions(); otlpOptions.Endpoint != "" {
+		// The node of the resource is the one the commands run against
+		if node == "" {
+			node = config.GetCtlOptions().Node
+		}
+		if _, ok := otlpOptions.ResourceAttributes["rabbitmq.node"]; !ok && node != "" {
+			otlpOptions.ResourceAttributes["rabbitmq.node"] = node
+		}
+		if _, ok := otlpOptions.ResourceAttributes["rabbitmq.cluster"]; !ok {
+			if cluster := detectClusterName(rmqCollectors); cluster != "" {
+				otlpOptions.ResourceAttributes["rabbitmq.cluster"] = cluster
+			}
+		}
+		otlpExporter, err := exporters.NewOTLPExporter(otlpOptions)
+		if err != nil {
+			log.Fatalf("invalid OTLP options: %v", err)
+		}
+		pushers = append(pushers, otlpExporter)
+	}
+	if dogStatsDOptions := config.GetDogStatsDOptions(prefix); dogStatsDOptions.Address != "" {
+		sender, err := exporters.NewDogStatsDSender(dogStatsDOptions)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pushers = append(pushers, sender)
+	}
+	if influxDBOptions := config.GetInfluxDBOptions(); influxDBOptions.URL != "" || influxDBOptions.Stdout {
+		writer, err := exporters.NewInfluxDBWriter(influxDBOptions)
+		if err != nil {
+			log.Fatalf("invalid InfluxDB options: %v", err)
+		}
+		pushers = append(pushers, writer)
+	}
+	return pushers
+}
+
+// The name of the cluster is detected once at startup, it's left out when the node is down
+func detectClusterName(rmqCollectors []exporters.ICollector) string {
+	for _, collector := range rmqCollectors {
+		if detector, ok := collector.(collectors.IClusterNameDetector); ok {
+			cluster, err := detector.DetectClusterName()
+			if err != nil {
+				log.Warningf("RMQ cluster name not detected: %v", err)
+				return ""
+			}
+			return cluster
+		}
+	}
+	return ""
+}
 
+// The alerts are only evaluated when there are rules in the config file
+func loadAlerts(config *collectors.ConfigSnapshot) *exporters.AlertEvaluator {
+	alertOptions, err := config.GetAlertOptions()
+	if err != nil {
+		log.Fatalf("invalid alerting options: %v", err)
+	}
+	if len(alertOptions.Rules) == 0 {
+		return nil
+	}
+	alerts, err := exporters.NewAlertEvaluator(alertOptions)
+	if err != nil {
+		log.Fatalf("invalid alerting options: %v", err)
+	}
+	return alerts
+}
+
+func runPushLoop(exporter *exporters.PrometheusExporter, pushers []exporters.IPusher, interval time.Duration) {
+	for _, pusher := range pushers {
+		log.Infof("Collector agent pushing metrics to %s every %v", pusher.GetName(), interval)
+	}
+	exporters.NewPushLoop(exporter, pushers, interval).Run()
+}
+
+func startExporter(exporter *exporters.PrometheusExporter) {
 	log.Infof("Collector agent running")
 	log.Fatal(exporter.Init())
 }
 
+// The management API provides the queue metrics like rabbitmqctl and also node and cluster metrics
+func managementCollectors(config *collectors.Config, timeoutMs int, startupChecks bool) []exporters.ICollector {
+	managementOptions := config.Snapshot().GetManagementOptions()
+	managementOptions.TimeoutMs = timeoutMs
+	client, err := collectors.NewManagementClient(managementOptions)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if startupChecks {
+		checkClient := *client
+		checkClient.HTTPClient = &http.Client{Transport: client.HTTPClient.Transport, Timeout: startupCheckTimeout}
+		if err := checkClient.Get("/api/overview", nil, &map[string]interface{}{}); err != nil {
+			log.Warningf("management API is not responding: %v", err)
+		} else {
+			log.Info("Management API is responding")
+		}
+	}
+
+	var rmqCollectors []exporters.ICollector
+	for _, resource := range []string{collectors.ManagementQueues, collectors.ManagementNodes, collectors.ManagementOverview} {
+		collector, err := collectors.NewManagementCollector(resource, client, config)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rmqCollectors = append(rmqCollectors, collector)
+	}
+	return rmqCollectors
+}
+
 func configureLogLevel(strLogLevel string) {
 	logLevel, err := log.ParseLevel(strLogLevel)
 	if err != nil {
@@ -55,31 +273,70 @@ func configureLogLevel(strLogLevel string) {
 	log.SetLevel(logLevel)
 }
 
+// The flags set in the command line override the options of the config file
+func loadCtlOptions(config *collectors.Config, setFlag func(*collectors.CtlOptions, *flag.Flag)) collectors.CtlOptions {
+	ctlOptions := config.Snapshot().GetCtlOptions()
+	flag.Visit(func(f *flag.Flag) {
+		setFlag(&ctlOptions, f)
+	})
+	if err := ctlOptions.Validate(); err != nil {
+		log.Fatalf("invalid rabbitmqctl options: %v", err)
+	}
+	return ctlOptions
+}
+
+// Timeout of the startup checks, shorter than the one of the collections (-timeout)
+const startupCheckTimeout = 10 * time.Second
+
+// rabbitmqctl can only be checked when it runs locally, otherwise docker or kubectl are checked
+func checkCollector(collector *collectors.CmdCollector, executorOptions collectors.ExecutorOptions) {
+	checkCmd := executorOptions.CheckCmd
+	if executorOptions.IsLocal() {
+		checkCmd = collector.CtlOptions.CheckCmd
+	}
+	if err := checkCmd(); err != nil {
+		log.Fatal(err)
+	}
+	// The node can be started after the agent, the collections fail until it responds
+	if err := collector.CheckNode(startupCheckTimeout); err != nil {
+		log.Warning(err)
+		return
+	}
+	log.Info("RMQ node is responding")
+}
+
 func queueParserFactory(strParser string, config collectors.IConfig) collectors.ICmdParser {
-	if strParser == "tabular" {
+	switch strParser {
+	case "auto":
+		return collectors.NewQueueAutoParser(config)
+	case "tabular":
 		return collectors.NewQueueParser(config)
+	case "tabular_header":
+		return collectors.NewQueueTableParser(config)
+	case "erlang":
+		return collectors.NewQueueErlangParser(config)
+	case "erlang_eval":
+		return collectors.NewQueueErlangEvalParser(config)
 	}
 
 	return collectors.NewQueueJSONParser(config)
 }
 
-func loadConfig(configFilePath string) collectors.IConfig {
+// A missing config file is not an error since the flags have defaults, an invalid one is
+func loadConfig(configFilePath string) *collectors.Config {
 	config, err := collectors.NewConfig(configFilePath)
-	if err != nil {
+	if os.IsNotExist(err) {
 		log.Warningf("error loading config: %v", err)
-		return config
+	} else if err != nil {
+		log.Fatalf("invalid config file %s: %v", configFilePath, err)
 	}
-
-	if !config.IsEmpty() {
-		config.OnConfigChange(func(e fsnotify.Event) {
-			log.Infof("Config file changed: %s", e.Name)
-			if err := config.Init(); err != nil {
-				log.Fatal(err)
-			}
-			log.Info("Config reloaded")
-		})
-		config.WatchConfig()
-	}
-
 	return config
+}
+
+// The config is reloaded when the file changes, on SIGHUP and on POST /-/reload
+func watchConfig(config *collectors.Config, prefix string) {
+	reloader := collectors.NewConfigReloader(config, prefix)
+	prometheus.MustRegister(reloader)
+	http.Handle("/-/reload", reloader)
+	reloader.Watch()
 }
\ No newline at end of file
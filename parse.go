@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"rmq-console-exporter/pkg/collectors"
+	"rmq-console-exporter/pkg/exporters"
+)
+
+// rmq-console-exporter parse [flags] [file]
+// Parses the output of rabbitmqctl captured in a file (or stdin) and prints the metrics, the queues are filtered
+// with the config file as when the exporter runs.
+func runParse(arguments []string) int {
+	flags := flag.NewFlagSet("parse", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s parse [flags] [file (default stdin)]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	qParser := flags.String("queue_parser", "json", "Queue Parser the output was captured for: json, tabular, tabular_header, erlang or erlang_eval")
+	format := flags.String("format", exporters.OutputProm, "Output format: prom, json, csv or influx")
+	prefix := flags.String("prefix", "rmq_", "Metrics prefix")
+	configFilePath := flags.String("config_file", "", "Config file with the queue filters")
+	timeoutMs := flags.Int("timeout", 600000, "Timeout[Ms] to parse the file")
+	level := flags.String("log_level", "warn", "Log Level: debug, info, error, etc")
+	_ = flags.Parse(arguments)
+
+	configureLogLevel(*level)
+	path := "-"
+	if flags.NArg() > 0 {
+		path = flags.Arg(0)
+	}
+	// The auto parser needs to run rabbitmqctl to detect the version
+	if *qParser == "auto" {
+		log.Error("the auto queue parser can't be used to parse a file")
+		return 2
+	}
+
+	config := loadConfig(*configFilePath)
+	collector := collectors.NewCmdCollector(queueParserFactory(*qParser, config), collectors.NewFileExecutorFactory(path), *timeoutMs, 100)
+	exporter := exporters.NewPrometheusExporter(*prefix, 0, []exporters.ICollector{collector})
+
+	families, err := exporter.Gather()
+	if err != nil {
+		log.Errorf("parsing %s failed: %v", path, err)
+		return 1
+	}
+	if err := exporters.WriteMetrics(os.Stdout, families, *format); err != nil {
+		log.Error(err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Output of rabbitmqctl list_queues name state messages_ready captured in a file
+const testListQueues = "Listing queues for vhost / ...\nname\tstate\tmessages_ready\norders\trunning\t3\nbilling\trunning\t5\n"
+
+// Output written to stdout by the function with its exit status
+func captureStdout(t *testing.T, run func() int) (string, int) {
+	reader, writer, err := os.Pipe()
+	assert.Nil(t, err)
+	stdout := os.Stdout
+	os.Stdout = writer
+	status := run()
+	os.Stdout = stdout
+	assert.Nil(t, writer.Close())
+	output, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	return string(output), status
+}
+
+func writeTestFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestParseFile(t *testing.T) {
+	path := writeTestFile(t, "list_queues.txt", testListQueues)
+	output, status := captureStdout(t, func() int {
+		return runParse([]string{"-queue_parser", "tabular_header", "-prefix", "test_", path})
+	})
+	assert.Equal(t, 0, status)
+	assert.Contains(t, output, `test_messages_ready{queue="orders",state="running"} 3`)
+	assert.Contains(t, output, `test_messages_ready{queue="billing",state="running"} 5`)
+
+	// The queues are filtered with the config file
+	configPath := writeTestFile(t, "config.toml", "[filters]\nqueues = ['^orders']\n")
+	output, status = captureStdout(t, func() int {
+		return runParse([]string{"-queue_parser", "tabular_header", "-config_file", configPath, "-format", "json", path})
+	})
+	assert.Equal(t, 0, status)
+	assert.Contains(t, output, `"name": "rmq_messages_ready"`)
+	assert.Contains(t, output, `"queue": "orders"`)
+	assert.NotContains(t, output, "billing")
+}
+
+func TestParseErrors(t *testing.T) {
+	path := writeTestFile(t, "list_queues.txt", testListQueues)
+	// The auto parser needs a node to detect the version
+	assert.Equal(t, 2, runParse([]string{"-queue_parser", "auto", path}))
+
+	output, status := captureStdout(t, func() int {
+		return runParse([]string{"-queue_parser", "tabular_header", filepath.Join(t.TempDir(), "missing.txt")})
+	})
+	assert.Equal(t, 1, status)
+	assert.Empty(t, output)
+
+	_, status = captureStdout(t, func() int {
+		return runParse([]string{"-queue_parser", "tabular_header", "-format", "xml", path})
+	})
+	assert.Equal(t, 1, status)
+}
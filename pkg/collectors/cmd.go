@@ -3,18 +3,61 @@ package collectors
 import (
 	"context"
 	"errors"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
+	"regexp"
 	"rmq-console-exporter/pkg/exporters"
+	"sync"
 	"time"
 )
 
+// Node names are passed as arguments to the command, so they can't look like an option
+var validNode = regexp.MustCompile(`^[^-\s][^\s]*$`)
+
+// Name printed by rabbitmqctl cluster_status: Cluster name: rabbit@host (3.8+) or {cluster_name,<<"rabbit@host">>}
+var clusterName = regexp.MustCompile(`^\s*Cluster name: (.+?)\s*$|\{cluster_name,<<"(.*?)">>\}`)
+
 type ICmdParser interface {
+	GetName() string
 	GetCmd() string
 	GetArguments() []string
 	Parse(string) (*Metrics, error)
 }
 
+// Parsers that can return several metrics for one line and keep state between lines (e.g. Erlang terms).
+// A new copy of the parser is used for every collection.
+type IMultiCmdParser interface {
+	ParseAll(string) ([]*Metrics, error)
+	Copy() IMultiCmdParser
+}
+
+// Parsers that filter the queues with the config. Every collection uses a copy of the parser with a snapshot of the
+// config, so a reload doesn't change the filters in the middle of a collection.
+type IConfigCmdParser interface {
+	ICmdParser
+	GetConfig() IConfig
+	WithConfig(config IConfig) ICmdParser
+}
+
+// Parsers of commands that don't accept -p <vhost> right after the command
+type IVhostCmdParser interface {
+	GetVhostArguments(vhost string) []string
+}
+
+// Parsers that depend on the version of the RMQ node, see QueueAutoParser
+type IVersionedCmdParser interface {
+	ICmdParser
+	GetVersion() string
+	SetVersion(version string) error
+	Undetected() IVersionedCmdParser
+}
+
+// Collectors that can get the name of the cluster of their node, see CmdCollector and ManagementCollector
+type IClusterNameDetector interface {
+	DetectClusterName() (string, error)
+}
+
 type IExecutor interface {
 	Output() <-chan string
 	Execute(ctx context.Context) error
@@ -24,6 +67,10 @@ type IExecutorFactory interface {
 	NewExecutor(command string, arguments []string, outputBuffer int) IExecutor
 }
 
+type ICookieProvider interface {
+	GetErlangCookie(node string) string
+}
+
 type NonFatalError struct {
 	err error
 }
@@ -42,6 +89,32 @@ type CmdCollector struct {
 	OutputBuffer		int
 	ExecutorFactory 	IExecutorFactory
 	ActiveExecutor		IExecutor
+	// Per scrape overrides, see WithFilters
+	QueueFilter			*Filter
+	Vhost				string
+	CtlOptions			CtlOptions
+	// Cookies of the remote nodes to collect from, see WithTarget
+	CookieProvider		ICookieProvider
+	// Shared by the copies of the collector, see WithTarget
+	targetParsers		*targetParsers
+}
+
+// Versioned parsers of the probed nodes by target, so the version of a node is detected at its first probe and
+// after a failed one instead of at every probe
+type targetParsers struct {
+	mutex	sync.Mutex
+	parsers	map[string]IVersionedCmdParser
+}
+
+func (t *targetParsers) get(target string, parser IVersionedCmdParser) IVersionedCmdParser {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if targetParser, ok := t.parsers[target]; ok {
+		return targetParser
+	}
+	targetParser := parser.Undetected()
+	t.parsers[target] = targetParser
+	return targetParser
 }
 
 func NewCmdCollector(parser ICmdParser, executorFactory IExecutorFactory, timeoutMs int, outputBuffer int) *CmdCollector {
@@ -51,11 +124,151 @@ func NewCmdCollector(parser ICmdParser, executorFactory IExecutorFactory, timeou
 		ExecutorFactory: executorFactory,
 		OutputBuffer: outputBuffer,
 		ActiveExecutor: nil, // Just for documentation, no need to initialize
+		targetParsers: &targetParsers{parsers: make(map[string]IVersionedCmdParser)},
+	}
+}
+
+func (c *CmdCollector) GetName() string {
+	return c.Parser.GetName()
+}
+
+// Empty for the default vhost of rabbitmqctl
+func (c *CmdCollector) GetVhost() string {
+	return c.Vhost
+}
+
+// Returns a copy of the collector that only keeps the queues matching the regex and runs the command on the vhost
+func (c *CmdCollector) WithFilters(filters exporters.ScrapeFilters) (exporters.ICollector, error) {
+	collector := c.copy()
+	collector.Vhost = filters.Vhost
+	if filters.QueueRegex != "" {
+		queueFilter, err := NewFilter([]string{filters.QueueRegex})
+		if err != nil { return nil, err }
+		collector.QueueFilter = queueFilter
+	}
+	return collector, nil
+}
+
+// Returns a copy of the collector that runs the command against the target node (-n) with its Erlang cookie
+func (c *CmdCollector) WithTarget(target string) (exporters.ICollector, error) {
+	if !validNode.MatchString(target) {
+		return nil, fmt.Errorf("invalid target node %q", target)
+	}
+	collector := c.copy()
+	collector.CtlOptions.Node = target
+	if versionedParser, ok := c.Parser.(IVersionedCmdParser); ok {
+		collector.Parser = c.targetParsers.get(target, versionedParser)
+	}
+	if c.CookieProvider != nil {
+		if cookie := c.CookieProvider.GetErlangCookie(target); cookie != "" {
+			collector.CtlOptions.ErlangCookie = cookie
+		}
+	}
+	return collector, nil
+}
+
+func (c *CmdCollector) copy() *CmdCollector {
+	collector := *c
+	collector.ActiveExecutor = nil
+	return &collector
+}
+
+// Runs the status command to check that the node responds with the configured options, the timeout replaces the
+// one of the collections so a node that is down doesn't block the startup
+func (c *CmdCollector) CheckNode(timeout time.Duration) error {
+	if _, err := c.runCtlWithTimeout("status", timeout); err != nil {
+		return fmt.Errorf("node is not responding to %s status: %v", c.getCmd(), err)
+	}
+	return nil
+}
+
+// Gets the version of the node with rabbitmqctl status. rabbitmqctl version (3.7+) is only the last fallback
+// since it prints the version of the CLI tools, which can differ from the one of the node.
+func (c *CmdCollector) DetectVersion() (string, error) {
+	output, err := c.runCtl("status")
+	if err == nil {
+		var version string
+		if version, err = findRabbitMQVersion(output); err == nil {
+			return version, nil
+		}
+	}
+	statusErr := fmt.Errorf("version of the node not found with %s status: %v", c.getCmd(), err)
+	output, err = c.runCtl("version")
+	if err != nil { return "", statusErr }
+	version, err := findRabbitMQVersion(output)
+	if err != nil { return "", statusErr }
+	log.Warningf("%v, using the version %s of the CLI tools", statusErr, version)
+	return version, nil
+}
+
+// Gets the name of the cluster of the node with rabbitmqctl cluster_status
+func (c *CmdCollector) DetectClusterName() (string, error) {
+	output, err := c.runCtl("cluster_status")
+	if err != nil { return "", fmt.Errorf("node is not responding to %s cluster_status: %v", c.getCmd(), err) }
+	return findClusterName(output)
+}
+
+func findClusterName(lines []string) (string, error) {
+	for _, line := range lines {
+		if match := clusterName.FindStringSubmatch(line); match != nil {
+			return match[1] + match[2], nil
+		}
+	}
+	return "", fmt.Errorf("cluster name not found")
+}
+
+// Detects the version again and updates the parser when it depends on it
+func (c *CmdCollector) UpdateVersion() error {
+	versionedParser, ok := c.Parser.(IVersionedCmdParser)
+	if !ok {
+		return nil
 	}
+	version, err := c.DetectVersion()
+	if err != nil { return err }
+	log.Infof("RabbitMQ version %s detected", version)
+	return versionedParser.SetVersion(version)
+}
+
+// Runs a rabbitmqctl command with the configured options and returns its output
+func (c *CmdCollector) runCtl(command string) ([]string, error) {
+	return c.runCtlWithTimeout(command, time.Duration(c.TimeoutMs) * time.Millisecond)
+}
+
+func (c *CmdCollector) runCtlWithTimeout(command string, timeout time.Duration) ([]string, error) {
+	arguments := append(c.CtlOptions.GetArguments(), command)
+	executor := c.ExecutorFactory.NewExecutor(c.getCmd(), arguments, c.OutputBuffer)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	outputCh := make(chan []string)
+	go func() {
+		var output []string
+		for line := range executor.Output() {
+			log.Debug(line)
+			output = append(output, line)
+		}
+		outputCh <- output
+	}()
+	err := executor.Execute(ctx)
+	output := <-outputCh
+	return output, err
 }
 
 func (c *CmdCollector) Collect() ([]exporters.IMetrics, error) {
-	c.ActiveExecutor = c.ExecutorFactory.NewExecutor(c.Parser.GetCmd(), c.Parser.GetArguments(), c.OutputBuffer)
+	// The version is detected at the first collection and after a failed one, the node can be upgraded meanwhile
+	versionedParser, isVersioned := c.Parser.(IVersionedCmdParser)
+	if isVersioned && versionedParser.GetVersion() == "" {
+		if err := c.UpdateVersion(); err != nil { return nil, err }
+	}
+	metrics, err := c.collect()
+	if err != nil && isVersioned {
+		_ = versionedParser.SetVersion("")
+	}
+	return metrics, err
+}
+
+func (c *CmdCollector) collect() ([]exporters.IMetrics, error) {
+	c.ActiveExecutor = c.ExecutorFactory.NewExecutor(c.getCmd(), c.getArguments(), c.OutputBuffer)
 	defer c.closeActiveExecutor()
 
 	log.Info("Starting collection of metrics from console")
@@ -65,6 +278,7 @@ func (c *CmdCollector) Collect() ([]exporters.IMetrics, error) {
 	defer cancel()
 
 	var metrics []exporters.IMetrics
+	parse := c.lineParser()
 
 	// Parsing command output
 	g.Go(func() error {
@@ -82,9 +296,11 @@ func (c *CmdCollector) Collect() ([]exporters.IMetrics, error) {
 					return nil
 				}
 				log.Debug(line)
-				metric, err := c.Parser.Parse(line)
+				lineMetrics, err := parse(line)
 				if err != nil && !errors.As(err, &nonFatalError) { return err }
-				if metric != nil { metrics = append(metrics, *metric) }
+				for _, metric := range lineMetrics {
+					if metric != nil && c.filterMetrics(metric) { metrics = append(metrics, *metric) }
+				}
 			case <-ctxError.Done():
 				return ctxError.Err()
 			}
@@ -107,6 +323,49 @@ func (c *CmdCollector) Collect() ([]exporters.IMetrics, error) {
 	return metrics, g.Wait()
 }
 
+func (c *CmdCollector) lineParser() func(string) ([]*Metrics, error) {
+	parser := c.Parser
+	if configParser, ok := parser.(IConfigCmdParser); ok {
+		parser = configParser.WithConfig(queueConfig(configParser.GetConfig(), c.QueueFilter))
+	}
+	if multiParser, ok := parser.(IMultiCmdParser); ok {
+		return multiParser.Copy().ParseAll
+	}
+	return func(line string) ([]*Metrics, error) {
+		metric, err := parser.Parse(line)
+		return []*Metrics{metric}, err
+	}
+}
+
+func (c *CmdCollector) getCmd() string {
+	return c.CtlOptions.GetCmd(c.Parser.GetCmd())
+}
+
+// The global options go before the command and the vhost right after it (e.g. -n node list_queues -p vhost ...)
+// as expected by all RMQ versions
+func (c *CmdCollector) getArguments() []string {
+	arguments := c.Parser.GetArguments()
+	if vhostParser, ok := c.Parser.(IVhostCmdParser); ok && c.Vhost != "" {
+		arguments = vhostParser.GetVhostArguments(c.Vhost)
+	} else if c.Vhost != "" && len(arguments) > 0 {
+		arguments = append([]string{arguments[0], "-p", c.Vhost}, arguments[1:]...)
+	}
+	return append(c.CtlOptions.GetArguments(), arguments...)
+}
+
+// Metrics without a queue label (e.g. command_runtime) are always kept
+func (c *CmdCollector) filterMetrics(metrics *Metrics) bool {
+	if c.QueueFilter == nil {
+		return true
+	}
+	for _, metric := range metrics.MetricPairs {
+		if queue, ok := metric.LabelPairs["queue"]; ok && !c.QueueFilter.Filter(queue) {
+			return false
+		}
+	}
+	return true
+}
+
 func (c *CmdCollector) closeActiveExecutor() {
 	c.ActiveExecutor = nil
 }
\ No newline at end of file
@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"github.com/stretchr/testify/assert"
+	"rmq-console-exporter/pkg/exporters"
 	"testing"
+	"time"
 )
 
 type TestExecutor struct {
@@ -84,6 +86,10 @@ func NewTestParserFail() *TestParserFail {
 	return &TestParserFail{}
 }
 
+func (p *TestParserFail) GetName() string {
+	return "fail"
+}
+
 func (p *TestParserFail) GetCmd() string {
 	return ""
 }
@@ -180,4 +186,168 @@ func TestJsonCollectOk(t *testing.T) {
 	labels, err := results[5].GetLabels("command_runtime")
 	assert.Nil(t, err)
 	assert.Equal(t, `rabbitmqctl list_queues --formatter json name state messages_ready`, labels["command_executed"])
-}
\ No newline at end of file
+}
+//============== TEST ================ //
+func TestCollectWithFilters(t *testing.T) {
+	console := NewCmdCollector(NewQueueParser(&TrueFilterConfig{}), NewTestExecutorFactory(), 1000000, 1000000)
+	filtered, err := console.WithFilters(exporters.ScrapeFilters{QueueRegex: `^.*\.dev$`, Vhost: "test"})
+	assert.Nil(t, err)
+	results, err := filtered.Collect()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, []string{"list_queues", "-p", "test", "name"}, filtered.(*CmdCollector).getArguments()[:4])
+	assert.Equal(t, "list_queues", console.getArguments()[0])
+	assert.Equal(t, "name", console.getArguments()[1])
+
+	// The queue_regex replaces the filters of the config file
+	console = NewCmdCollector(NewQueueParser(&FalseFilterConfig{}), NewTestExecutorFactory(), 1000000, 1000000)
+	filtered, err = console.WithFilters(exporters.ScrapeFilters{QueueRegex: `^.*\.dev$`})
+	assert.Nil(t, err)
+	results, err = filtered.Collect()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+
+	_, err = console.WithFilters(exporters.ScrapeFilters{QueueRegex: `^(.*$`})
+	assert.NotNil(t, err)
+}
+
+type TestCookieProvider struct{}
+
+func (p *TestCookieProvider) GetErlangCookie(node string) string {
+	return "cookie_" + node
+}
+
+//============== TEST ================ //
+func TestCollectWithTarget(t *testing.T) {
+	console := NewCmdCollector(NewQueueParser(&TrueFilterConfig{}), NewTestExecutorFactory(), 1000000, 1000000)
+	console.CookieProvider = &TestCookieProvider{}
+	filtered, err := console.WithFilters(exporters.ScrapeFilters{Vhost: "test"})
+	assert.Nil(t, err)
+	probe, err := filtered.(*CmdCollector).WithTarget("rabbit@node2")
+	assert.Nil(t, err)
+	results, err := probe.Collect()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(results))
+	expectedArguments := []string{"-n", "rabbit@node2", "--erlang-cookie", "cookie_rabbit@node2", "list_queues", "-p", "test"}
+	assert.Equal(t, expectedArguments, probe.(*CmdCollector).getArguments()[:7])
+	assert.Equal(t, "list_queues", console.getArguments()[0])
+
+	_, err = console.WithTarget("--help")
+	assert.NotNil(t, err)
+}
+
+//============== TEST ================ //
+func TestCollectWithCtlOptions(t *testing.T) {
+	console := NewCmdCollector(NewQueueParser(&TrueFilterConfig{}), NewTestExecutorFactory(), 1000000, 1000000)
+	console.CtlOptions = CtlOptions{Path: "/usr/sbin/rabbitmqctl", Node: "rabbit@node1", Quiet: true}
+
+	assert.Equal(t, "/usr/sbin/rabbitmqctl", console.getCmd())
+	assert.Equal(t, []string{"-n", "rabbit@node1", "-q", "list_queues", "name"}, console.getArguments()[:5])
+	assert.Nil(t, console.CheckNode(time.Second))
+
+	probe, err := console.WithTarget("rabbit@node2")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-n", "rabbit@node2", "-q", "list_queues"}, probe.(*CmdCollector).getArguments()[:4])
+}
+
+// Runs until the context is done, as a command on a node that doesn't respond
+type hangingExecutor struct {
+	outputCh	chan string
+}
+
+func (e *hangingExecutor) Output() <-chan string {
+	return e.outputCh
+}
+
+func (e *hangingExecutor) Execute(ctx context.Context) error {
+	defer close(e.outputCh)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type hangingExecutorFactory struct {}
+
+func (f *hangingExecutorFactory) NewExecutor(command string, arguments []string, outputBuffer int) IExecutor {
+	return &hangingExecutor{outputCh: make(chan string)}
+}
+
+//============== TEST ================ //
+func TestCheckNodeTimeout(t *testing.T) {
+	// The timeout of the collections is not used by the check
+	console := NewCmdCollector(NewQueueParser(&TrueFilterConfig{}), &hangingExecutorFactory{}, 1000000, 1000000)
+	start := time.Now()
+	err := console.CheckNode(50 * time.Millisecond)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "node is not responding to rabbitmqctl status")
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+//============== TEST ================ //
+func TestDetectClusterName(t *testing.T) {
+	factory := &TestVersionExecutorFactory{outputs: map[string][]string{
+		"cluster_status": {"Cluster status of node rabbit@node1 ...", "Basics", "", "Cluster name: rabbit@node1.example.com", ""},
+	}}
+	console := NewCmdCollector(NewQueueParser(&TrueFilterConfig{}), factory, 1000000, 1000000)
+	cluster, err := console.DetectClusterName()
+	assert.Nil(t, err)
+	assert.Equal(t, "rabbit@node1.example.com", cluster)
+
+	// RMQ 3.6 and 3.7
+	factory.outputs["cluster_status"] = []string{"[{nodes,[{disc,[rabbit@node1]}]},", ` {cluster_name,<<"prod cluster">>},`}
+	cluster, err = console.DetectClusterName()
+	assert.Nil(t, err)
+	assert.Equal(t, "prod cluster", cluster)
+
+	factory.outputs["cluster_status"] = []string{"Cluster status of node rabbit@node1 ..."}
+	_, err = console.DetectClusterName()
+	assert.NotNil(t, err)
+	delete(factory.outputs, "cluster_status")
+	_, err = console.DetectClusterName()
+	assert.NotNil(t, err)
+}
+
+type TestErlangExecutorFactory struct {}
+
+func (f *TestErlangExecutorFactory) NewExecutor(command string, arguments []string, outputBuffer int) IExecutor {
+	return &TestLinesExecutor{
+		outputCh: make(chan string, 100),
+		output: []string{
+			`Listing queues for vhost / ...`,
+			`[[{name,<<"q1.dev">>},{state,running},{messages_ready,1}],`,
+			` [{name,<<"q2.dev">>},`,
+			`  {state,running},{messages_ready,2}],[{name,<<"q3">>},{state,running},{messages_ready,3}]]`,
+		},
+	}
+}
+
+type TestLinesExecutor struct {
+	outputCh	chan string
+	output		[]string
+}
+
+func (e *TestLinesExecutor) Output() <-chan string {
+	return e.outputCh
+}
+
+func (e *TestLinesExecutor) Execute(ctx context.Context) error {
+	defer close(e.outputCh)
+	for _, line := range e.output {
+		e.outputCh <- line
+	}
+	return nil
+}
+
+//============== TEST ================ //
+func TestCollectErlangOk(t *testing.T) {
+	console := NewCmdCollector(NewQueueErlangParser(&TrueFilterConfig{}), &TestErlangExecutorFactory{}, 1000000, 1000000)
+	for i := 0; i < 2; i++ {
+		results, err := console.Collect()
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(results))
+		value, err := results[2].GetMetricValue("messages_ready")
+		assert.Nil(t, err)
+		assert.Equal(t, float64(3), value)
+	}
+}
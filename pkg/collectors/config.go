@@ -1,46 +1,129 @@
 package collectors
 
 import (
+	"errors"
+	"fmt"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 	"os"
 	"path/filepath"
+	"reflect"
+	"rmq-console-exporter/pkg/exporters"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
+// Tables read by every collection, the other ones are only read at startup (the flags, the executor, the outputs and
+// the alert rules)
+var reloadableTables = map[string]bool{"filters": true, "probe": true}
+
+// Config file loaded at startup and replaced as a whole by the reloads. The collections and the getters use a
+// snapshot, so they never see a config half reloaded.
 type Config struct {
+	current	atomic.Value
+	path	string
+}
+
+// Immutable config loaded from the file, it must not be modified after it's loaded
+type ConfigSnapshot struct {
 	*viper.Viper
 	queueFilter *Filter
 }
 
 func NewConfig(configFilePath string) (*Config, error) {
-	config := &Config{viper.New(), nil}
+	config := &Config{path: configFilePath}
+	config.current.Store(&ConfigSnapshot{newViper(configFilePath), nil})
 	if configFilePath == "" {
 		return config, nil
 	}
-	configFile := filepath.Base(configFilePath)
-	config.SetConfigName(strings.TrimSuffix(configFile, filepath.Ext(configFile)))
-	config.AddConfigPath(filepath.Dir(configFilePath))
 	if _, err := os.Stat(configFilePath); err != nil {
 		return config, err
 	}
-	err := config.Init()
-	return config, err
+	snapshot, err := loadConfigSnapshot(configFilePath)
+	if err != nil { return config, err }
+	config.current.Store(snapshot)
+	log.Infof("Config loaded from %v", snapshot.ConfigFileUsed())
+	return config, nil
 }
 
-func (c *Config) Init() error {
-	var err error
-	if err = c.ReadInConfig(); err != nil {
-		return err
+func newViper(configFilePath string) *viper.Viper {
+	v := viper.New()
+	if configFilePath != "" {
+		configFile := filepath.Base(configFilePath)
+		v.SetConfigName(strings.TrimSuffix(configFile, filepath.Ext(configFile)))
+		v.AddConfigPath(filepath.Dir(configFilePath))
 	}
-	if c.queueFilter, err = NewFilter(c.GetStringSlice("filters.queues")); err != nil {
-		return err
+	return v
+}
+
+// Reads and validates the config file
+func loadConfigSnapshot(configFilePath string) (*ConfigSnapshot, error) {
+	v := newViper(configFilePath)
+	if err := v.ReadInConfig(); err != nil { return nil, err }
+	snapshot := &ConfigSnapshot{Viper: v}
+	if err := snapshot.ValidateSchema(); err != nil { return nil, err }
+	queueFilter, err := NewFilter(v.GetStringSlice("filters.queues"))
+	if err != nil { return nil, fmt.Errorf("filters.queues: %v", err) }
+	snapshot.queueFilter = queueFilter
+	if _, err := snapshot.GetAlertOptions(); err != nil { return nil, err }
+	return snapshot, nil
+}
+
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Current config, the same snapshot must be used for a whole collection
+func (c *Config) Snapshot() *ConfigSnapshot {
+	return c.current.Load().(*ConfigSnapshot)
+}
+
+func (c *Config) snapshot() IConfig {
+	return c.Snapshot()
+}
+
+func (c *Config) filterQueue(name string) bool {
+	return c.Snapshot().filterQueue(name)
+}
+
+func (c *Config) GetErlangCookie(node string) string {
+	return c.Snapshot().GetErlangCookie(node)
+}
+
+// Reads the config file again and only applies it when it's valid, the previous config is kept on error
+func (c *Config) Reload() error {
+	if c.path == "" {
+		return errors.New("no config file to reload")
 	}
-	log.Infof("Config loaded from %v", c.ConfigFileUsed())
+	snapshot, err := loadConfigSnapshot(c.path)
+	if err != nil { return err }
+	if err := snapshot.checkReloadable(c.Snapshot()); err != nil { return err }
+	c.current.Store(snapshot)
+	log.Infof("Config reloaded from %v", snapshot.ConfigFileUsed())
 	return nil
 }
 
-func (c *Config) IsEmpty() bool {
+// A reload can't change the tables only read at startup, they would look applied while the agent still uses the
+// previous ones
+func (c *ConfigSnapshot) checkReloadable(previous *ConfigSnapshot) error {
+	var changed []string
+	for _, table := range append(sortedKeys(configSchema), ExporterTable) {
+		if !reloadableTables[table] && !reflect.DeepEqual(previous.Get(table), c.Get(table)) {
+			changed = append(changed, "[" + table + "]")
+		}
+	}
+	if len(changed) > 0 {
+		return fmt.Errorf("%s can't be reloaded, the agent must be restarted", strings.Join(changed, ", "))
+	}
+	return nil
+}
+
+func (c *ConfigSnapshot) snapshot() IConfig {
+	return c
+}
+
+func (c *ConfigSnapshot) IsEmpty() bool {
 	if c.queueFilter == nil {
 		return true
 	}
@@ -50,7 +133,205 @@ func (c *Config) IsEmpty() bool {
 	return true
 }
 
-func (c *Config) filterQueue(name string) bool {
+// Cookies per node are set in the probe.erlang_cookies table, the default one in probe.erlang_cookie
+func (c *ConfigSnapshot) GetErlangCookie(node string) string {
+	for cookieNode, cookie := range c.GetStringMapString("probe.erlang_cookies") {
+		if strings.EqualFold(cookieNode, node) {
+			return cookie
+		}
+	}
+	return c.GetString("probe.erlang_cookie")
+}
+
+// Options for the RMQ CLI tools set in the rabbitmqctl table
+func (c *ConfigSnapshot) GetCtlOptions() CtlOptions {
+	return CtlOptions{
+		Path: c.GetString("rabbitmqctl.path"),
+		Node: c.GetString("rabbitmqctl.node"),
+		LongNames: c.GetBool("rabbitmqctl.longnames"),
+		ErlangCookie: c.GetString("rabbitmqctl.erlang_cookie"),
+		TimeoutSec: c.GetInt("rabbitmqctl.timeout"),
+		Quiet: c.GetBool("rabbitmqctl.quiet"),
+		Arguments: c.GetStringSlice("rabbitmqctl.arguments"),
+	}
+}
+
+// Options to execute the commands through docker, kubectl or ssh set in the executor table
+func (c *ConfigSnapshot) GetExecutorOptions() ExecutorOptions {
+	return ExecutorOptions{
+		Type: c.GetString("executor.type"),
+		Path: c.GetString("executor.path"),
+		Container: c.GetString("executor.container"),
+		Pod: c.GetString("executor.pod"),
+		Namespace: c.GetString("executor.namespace"),
+		Arguments: c.GetStringSlice("executor.arguments"),
+		Host: c.GetString("executor.host"),
+		User: c.GetString("executor.user"),
+		KeyFile: c.GetString("executor.key_file"),
+		KnownHosts: c.GetString("executor.known_hosts"),
+	}
+}
+
+// Options of the management HTTP API set in the management table
+func (c *ConfigSnapshot) GetManagementOptions() ManagementOptions {
+	return ManagementOptions{
+		URL: c.GetString("management.url"),
+		Username: c.GetString("management.username"),
+		Password: c.GetString("management.password"),
+		PageSize: c.GetInt("management.page_size"),
+		InsecureSkipVerify: c.GetBool("management.insecure_skip_verify"),
+	}
+}
+
+// Options of the Pushgateway set in the pushgateway table, the metrics are only pushed when the url is set
+func (c *ConfigSnapshot) GetPushgatewayOptions() exporters.PushgatewayOptions {
+	retryDelay := c.GetDuration("pushgateway.retry_delay")
+	if retryDelay <= 0 {
+		retryDelay = time.Second
+	}
+	return exporters.PushgatewayOptions{
+		URL: c.GetString("pushgateway.url"),
+		Job: c.GetString("pushgateway.job"),
+		Grouping: c.GetStringMapString("pushgateway.grouping"),
+		Username: c.GetString("pushgateway.username"),
+		Password: c.GetString("pushgateway.password"),
+		Retries: c.GetInt("pushgateway.retries"),
+		RetryDelay: retryDelay,
+	}
+}
+
+// Options of the remote-write endpoint set in the remote_write table, the metrics are only sent when the url is set
+func (c *ConfigSnapshot) GetRemoteWriteOptions() exporters.RemoteWriteOptions {
+	retryDelay := c.GetDuration("remote_write.retry_delay")
+	if retryDelay <= 0 {
+		retryDelay = time.Second
+	}
+	timeout := c.GetDuration("remote_write.timeout")
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return exporters.RemoteWriteOptions{
+		URL: c.GetString("remote_write.url"),
+		Username: c.GetString("remote_write.username"),
+		Password: c.GetString("remote_write.password"),
+		BearerToken: c.GetString("remote_write.bearer_token"),
+		Headers: c.GetStringMapString("remote_write.headers"),
+		BatchSize: c.GetInt("remote_write.batch_size"),
+		Retries: c.GetInt("remote_write.retries"),
+		RetryDelay: retryDelay,
+		Timeout: timeout,
+	}
+}
+
+// Options of the OTLP endpoint set in the otlp table, the metrics are only sent when the endpoint is set.
+// The host.name resource attribute is set to the hostname unless it's in otlp.resource_attributes.
+func (c *ConfigSnapshot) GetOTLPOptions() exporters.OTLPOptions {
+	retryDelay := c.GetDuration("otlp.retry_delay")
+	if retryDelay <= 0 {
+		retryDelay = time.Second
+	}
+	timeout := c.GetDuration("otlp.timeout")
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	resourceAttributes := c.GetStringMapString("otlp.resource_attributes")
+	if _, ok := resourceAttributes["host.name"]; !ok {
+		if hostname, err := os.Hostname(); err == nil {
+			resourceAttributes["host.name"] = hostname
+		}
+	}
+	return exporters.OTLPOptions{
+		Endpoint: c.GetString("otlp.endpoint"),
+		Protocol: c.GetString("otlp.protocol"),
+		Headers: c.GetStringMapString("otlp.headers"),
+		ResourceAttributes: resourceAttributes,
+		CAFile: c.GetString("otlp.ca_file"),
+		CertFile: c.GetString("otlp.cert_file"),
+		KeyFile: c.GetString("otlp.key_file"),
+		InsecureSkipVerify: c.GetBool("otlp.insecure_skip_verify"),
+		Retries: c.GetInt("otlp.retries"),
+		RetryDelay: retryDelay,
+		Timeout: timeout,
+	}
+}
+
+// Options of the Datadog agent set in the dogstatsd table, the metrics are only sent when the address is set.
+// The prefix of the metrics is the one of the exporter unless dogstatsd.prefix is set (it can be empty).
+func (c *ConfigSnapshot) GetDogStatsDOptions(exporterPrefix string) exporters.DogStatsDOptions {
+	timeout := c.GetDuration("dogstatsd.timeout")
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	prefix := exporterPrefix
+	if c.IsSet("dogstatsd.prefix") {
+		prefix = c.GetString("dogstatsd.prefix")
+	}
+	return exporters.DogStatsDOptions{
+		Address: c.GetString("dogstatsd.address"),
+		Tags: c.GetStringSlice("dogstatsd.tags"),
+		PacketSize: c.GetInt("dogstatsd.packet_size"),
+		Timeout: timeout,
+		Prefix: prefix,
+		ExporterPrefix: exporterPrefix,
+	}
+}
+
+// Options of InfluxDB set in the influxdb table, the metrics are sent when the url is set or stdout is true
+func (c *ConfigSnapshot) GetInfluxDBOptions() exporters.InfluxDBOptions {
+	retryDelay := c.GetDuration("influxdb.retry_delay")
+	if retryDelay <= 0 {
+		retryDelay = time.Second
+	}
+	timeout := c.GetDuration("influxdb.timeout")
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return exporters.InfluxDBOptions{
+		URL: c.GetString("influxdb.url"),
+		Stdout: c.GetBool("influxdb.stdout"),
+		Org: c.GetString("influxdb.org"),
+		Bucket: c.GetString("influxdb.bucket"),
+		Token: c.GetString("influxdb.token"),
+		Retries: c.GetInt("influxdb.retries"),
+		RetryDelay: retryDelay,
+		Timeout: timeout,
+	}
+}
+
+type alertRuleConfig struct {
+	Name		string			`mapstructure:"name"`
+	QueueRegex	string			`mapstructure:"queue_regex"`
+	Condition	string			`mapstructure:"condition"`
+	For			time.Duration	`mapstructure:"for"`
+}
+
+// The rules are the [[alerting.rules]] tables, the durations are strings like "5m"
+func (c *ConfigSnapshot) GetAlertOptions() (exporters.AlertOptions, error) {
+	var ruleConfigs []alertRuleConfig
+	if err := c.UnmarshalKey("alerting.rules", &ruleConfigs); err != nil { return exporters.AlertOptions{}, err }
+	rules := make([]exporters.AlertRule, len(ruleConfigs))
+	for i, rule := range ruleConfigs {
+		rules[i] = exporters.AlertRule(rule)
+	}
+	retryDelay := c.GetDuration("alerting.retry_delay")
+	if retryDelay <= 0 {
+		retryDelay = time.Second
+	}
+	timeout := c.GetDuration("alerting.timeout")
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return exporters.AlertOptions{
+		WebhookURL: c.GetString("alerting.webhook_url"),
+		Headers: c.GetStringMapString("alerting.headers"),
+		Rules: rules,
+		Retries: c.GetInt("alerting.retries"),
+		RetryDelay: retryDelay,
+		Timeout: timeout,
+	}, nil
+}
+
+func (c *ConfigSnapshot) filterQueue(name string) bool {
 	if c.IsEmpty() {
 		return true
 	}
@@ -0,0 +1,109 @@
+package collectors
+
+import (
+	"github.com/fsnotify/fsnotify"
+	"github.com/prometheus/client_golang/prometheus"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Reloads the config when the file changes, on SIGHUP or on POST /-/reload. A reload that fails keeps the previous
+// config and is reported by the metrics, so a typo in the file doesn't stop the exporter.
+type ConfigReloader struct {
+	Config					*Config
+	mutex					sync.Mutex
+	lastReloadSuccessful	prometheus.Gauge
+	lastReloadSuccess		prometheus.Gauge
+	reloadFailures			prometheus.Counter
+}
+
+func NewConfigReloader(config *Config, prefix string) *ConfigReloader {
+	reloader := &ConfigReloader{
+		Config: config,
+		lastReloadSuccessful: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prefix + "config_last_reload_successful",
+			Help: "Whether the last reload of the config file succeeded.",
+		}),
+		lastReloadSuccess: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prefix + "config_last_reload_success_timestamp_seconds",
+			Help: "Timestamp of the last successful reload of the config file.",
+		}),
+		reloadFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prefix + "config_reload_failures_total",
+			Help: "Number of reloads of the config file that failed.",
+		}),
+	}
+	// Without a config file there is nothing to fail
+	reloader.lastReloadSuccessful.Set(1)
+	reloader.lastReloadSuccess.SetToCurrentTime()
+	return reloader
+}
+
+func (r *ConfigReloader) Describe(ch chan<- *prometheus.Desc) {
+	r.lastReloadSuccessful.Describe(ch)
+	r.lastReloadSuccess.Describe(ch)
+	r.reloadFailures.Describe(ch)
+}
+
+func (r *ConfigReloader) Collect(ch chan<- prometheus.Metric) {
+	r.lastReloadSuccessful.Collect(ch)
+	r.lastReloadSuccess.Collect(ch)
+	r.reloadFailures.Collect(ch)
+}
+
+func (r *ConfigReloader) Reload(trigger string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	log.Infof("Reloading the config file (%s)", trigger)
+	if err := r.Config.Reload(); err != nil {
+		log.Errorf("Config reload failed, keeping the previous config: %v", err)
+		r.lastReloadSuccessful.Set(0)
+		r.reloadFailures.Inc()
+		return err
+	}
+	r.lastReloadSuccessful.Set(1)
+	r.lastReloadSuccess.Set(float64(time.Now().UnixNano()) / 1e9)
+	return nil
+}
+
+// Watches the config file and SIGHUP, the file is watched even when it's empty or invalid at startup. The file is
+// reloaded first so the metrics report whether the initial config is valid.
+func (r *ConfigReloader) Watch() {
+	if r.Config.Path() == "" {
+		return
+	}
+	_ = r.Reload("startup")
+	// The watcher of viper reads the file in its own instance, it's only used for the notifications
+	watcher := newViper(r.Config.Path())
+	watcher.OnConfigChange(func(e fsnotify.Event) {
+		_ = r.Reload("file changed: " + e.Name)
+	})
+	watcher.WatchConfig()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			_ = r.Reload("SIGHUP")
+		}
+	}()
+}
+
+// POST /-/reload as in Prometheus, the error is returned when the reload fails
+func (r *ConfigReloader) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost && request.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "only POST or PUT requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.Reload("HTTP request"); err != nil {
+		http.Error(w, "failed to reload config: " + err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
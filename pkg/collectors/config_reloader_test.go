@@ -0,0 +1,102 @@
+package collectors
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, path string, content string) {
+	assert.Nil(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func TestConfigReloadKeepsConfigOnError(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	writeConfig(t, configPath, "[filters]\nqueues = ['^.*\\.dev$']\n")
+	config, err := NewConfig(configPath)
+	assert.Nil(t, err)
+	reloader := NewConfigReloader(config, "test_")
+	assert.True(t, config.filterQueue("object_test.dev"))
+
+	// Invalid regex
+	writeConfig(t, configPath, "[filters]\nqueues = ['^.*\\.super\\..*$', '(']\n")
+	assert.NotNil(t, reloader.Reload("test"))
+	assert.True(t, config.filterQueue("object_test.dev"))
+	assert.Equal(t, 0.0, testutil.ToFloat64(reloader.lastReloadSuccessful))
+	assert.Equal(t, 1.0, testutil.ToFloat64(reloader.reloadFailures))
+
+	// Invalid TOML
+	writeConfig(t, configPath, "[filters\nqueues = ['^.*\\.super\\..*$']\n")
+	assert.NotNil(t, reloader.Reload("test"))
+	assert.True(t, config.filterQueue("object_test.dev"))
+
+	// Invalid alert rule
+	writeConfig(t, configPath, "[filters]\nqueues = ['^.*\\.super\\..*$']\n[[alerting.rules]]\nfor = 'soon'\n")
+	assert.NotNil(t, reloader.Reload("test"))
+	assert.True(t, config.filterQueue("object_test.dev"))
+	assert.Equal(t, 3.0, testutil.ToFloat64(reloader.reloadFailures))
+
+	writeConfig(t, configPath, "[filters]\nqueues = ['^.*\\.super\\..*$']\n")
+	assert.Nil(t, reloader.Reload("test"))
+	assert.False(t, config.filterQueue("object_test.dev"))
+	assert.Equal(t, 1.0, testutil.ToFloat64(reloader.lastReloadSuccessful))
+}
+
+func TestConfigReloadStartupTables(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	writeConfig(t, configPath, "[exporter]\nport = 2112\n[otlp]\nendpoint = 'http://localhost:4318'\n")
+	config, err := NewConfig(configPath)
+	assert.Nil(t, err)
+	reloader := NewConfigReloader(config, "test_")
+
+	// The tables only read at startup can't change
+	writeConfig(t, configPath, "[exporter]\nport = 2113\n[otlp]\nendpoint = 'http://localhost:4318'\n[alerting]\nretries = 2\n")
+	err = reloader.Reload("test")
+	assert.EqualError(t, err, "[alerting], [exporter] can't be reloaded, the agent must be restarted")
+	assert.Equal(t, 2112, config.Snapshot().GetInt("exporter.port"))
+
+	writeConfig(t, configPath, "[exporter]\nport = 2112\n[otlp]\nendpoint = 'http://localhost:4318'\n" +
+		"[filters]\nqueues = ['^.*\\.dev$']\n[probe]\nerlang_cookie = 'cookie'\n")
+	assert.Nil(t, reloader.Reload("test"))
+	assert.Equal(t, "cookie", config.GetErlangCookie("rabbit@node2"))
+}
+
+func TestConfigReloadHTTP(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	writeConfig(t, configPath, "[filters]\nqueues = ['^.*\\.dev$']\n")
+	config, _ := NewConfig(configPath)
+	reloader := NewConfigReloader(config, "test_")
+
+	recorder := httptest.NewRecorder()
+	reloader.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/-/reload", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+
+	recorder = httptest.NewRecorder()
+	reloader.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	writeConfig(t, configPath, "[filters]\nqueues = ['(']\n")
+	recorder = httptest.NewRecorder()
+	reloader.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	assert.Equal(t, http.StatusInternalServerError, recorder.Code)
+}
+
+// The file is watched even when it doesn't have filters at startup
+func TestConfigReloadWatch(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	writeConfig(t, configPath, "")
+	config, _ := NewConfig(configPath)
+	reloader := NewConfigReloader(config, "test_")
+	reloader.Watch()
+	assert.True(t, config.filterQueue("object_test.dev"))
+
+	writeConfig(t, configPath, "[filters]\nqueues = ['^.*\\.super\\..*$']\n")
+	assert.Eventually(t, func() bool { return !config.filterQueue("object_test.dev") }, 2 * time.Second, 10*time.Millisecond)
+	os.Remove(configPath)
+}
@@ -0,0 +1,344 @@
+package collectors
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of values of the config file
+const (
+	kindString		= "string"
+	kindInt			= "integer"
+	kindBool		= "boolean"
+	kindDuration	= "duration"
+	kindStrings		= "list of strings"
+	kindStringMap	= "table of strings"
+	kindAlertRules	= "list of alert rules"
+)
+
+// Prefix of the environment variables that set the flags, e.g. RMQ_EXPORTER_PORT=2113
+const EnvPrefix = "RMQ_EXPORTER_"
+
+// Table of the config file with the flags of the exporter
+const ExporterTable = "exporter"
+
+// Every key of the config file by table, the exporter table is validated with the flags (see SetFlags)
+var configSchema = map[string]map[string]string{
+	"filters": {
+		"queues": kindStrings,
+	},
+	"rabbitmqctl": {
+		"path": kindString,
+		"node": kindString,
+		"longnames": kindBool,
+		"erlang_cookie": kindString,
+		"timeout": kindInt,
+		"quiet": kindBool,
+		"arguments": kindStrings,
+	},
+	"executor": {
+		"type": kindString,
+		"path": kindString,
+		"container": kindString,
+		"pod": kindString,
+		"namespace": kindString,
+		"arguments": kindStrings,
+		"host": kindString,
+		"user": kindString,
+		"key_file": kindString,
+		"known_hosts": kindString,
+	},
+	"management": {
+		"url": kindString,
+		"username": kindString,
+		"password": kindString,
+		"page_size": kindInt,
+		"insecure_skip_verify": kindBool,
+	},
+	"probe": {
+		"erlang_cookie": kindString,
+		"erlang_cookies": kindStringMap,
+	},
+	"pushgateway": {
+		"url": kindString,
+		"job": kindString,
+		"grouping": kindStringMap,
+		"username": kindString,
+		"password": kindString,
+		"retries": kindInt,
+		"retry_delay": kindDuration,
+	},
+	"remote_write": {
+		"url": kindString,
+		"username": kindString,
+		"password": kindString,
+		"bearer_token": kindString,
+		"headers": kindStringMap,
+		"batch_size": kindInt,
+		"retries": kindInt,
+		"retry_delay": kindDuration,
+		"timeout": kindDuration,
+	},
+	"otlp": {
+		"endpoint": kindString,
+		"protocol": kindString,
+		"headers": kindStringMap,
+		"resource_attributes": kindStringMap,
+		"ca_file": kindString,
+		"cert_file": kindString,
+		"key_file": kindString,
+		"insecure_skip_verify": kindBool,
+		"retries": kindInt,
+		"retry_delay": kindDuration,
+		"timeout": kindDuration,
+	},
+	"dogstatsd": {
+		"address": kindString,
+		"tags": kindStrings,
+		"packet_size": kindInt,
+		"timeout": kindDuration,
+		"prefix": kindString,
+	},
+	"influxdb": {
+		"url": kindString,
+		"stdout": kindBool,
+		"org": kindString,
+		"bucket": kindString,
+		"token": kindString,
+		"retries": kindInt,
+		"retry_delay": kindDuration,
+		"timeout": kindDuration,
+	},
+	"alerting": {
+		"webhook_url": kindString,
+		"headers": kindStringMap,
+		"retries": kindInt,
+		"retry_delay": kindDuration,
+		"timeout": kindDuration,
+		"rules": kindAlertRules,
+	},
+}
+
+var alertRuleSchema = map[string]string{
+	"name": kindString,
+	"queue_regex": kindString,
+	"condition": kindString,
+	"for": kindDuration,
+}
+
+// Checks that all the tables and keys of the config file exist and their values have the right kind, all the
+// errors are returned so they can be fixed at once
+func (c *ConfigSnapshot) ValidateSchema() error {
+	var errs []string
+	settings := c.AllSettings()
+	for _, table := range sortedKeys(settings) {
+		if table == ExporterTable { continue }
+		keys, ok := configSchema[table]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unknown table [%s], the tables are: %s", table, strings.Join(sortedKeys(configSchema), ", ")))
+			continue
+		}
+		values, ok := settings[table].(map[string]interface{})
+		if !ok {
+			errs = append(errs, fmt.Sprintf("%s must be a table", table))
+			continue
+		}
+		errs = append(errs, validateTable(table, values, keys)...)
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func validateTable(table string, values map[string]interface{}, keys map[string]string) []string {
+	var errs []string
+	for _, key := range sortedKeys(values) {
+		kind, ok := keys[key]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("unknown key %s.%s, the keys of [%s] are: %s", table, key, table, strings.Join(sortedKeys(keys), ", ")))
+			continue
+		}
+		if err := validateKind(values[key], kind); err != nil {
+			errs = append(errs, fmt.Sprintf("%s.%s: %v", table, key, err))
+		}
+	}
+	return errs
+}
+
+func validateKind(value interface{}, kind string) error {
+	valid := false
+	switch kind {
+	case kindString:
+		_, valid = value.(string)
+	case kindInt:
+		switch value.(type) {
+		case int, int32, int64:
+			valid = true
+		}
+	case kindBool:
+		_, valid = value.(bool)
+	case kindDuration:
+		duration, ok := value.(string)
+		if !ok { break }
+		if _, err := time.ParseDuration(duration); err != nil {
+			return fmt.Errorf("invalid duration %q, e.g. 30s, 5m or 1h", duration)
+		}
+		valid = true
+	case kindStrings:
+		list, ok := value.([]interface{})
+		valid = ok
+		for _, item := range list {
+			if _, ok := item.(string); !ok { valid = false }
+		}
+	case kindStringMap:
+		valid = isStringTable(value)
+	case kindAlertRules:
+		rules, ok := value.([]interface{})
+		if !ok { break }
+		var errs []string
+		for i, rule := range rules {
+			ruleValues, ok := rule.(map[string]interface{})
+			if !ok { return fmt.Errorf("rule %d must be a table ([[alerting.rules]])", i + 1) }
+			errs = append(errs, validateTable(fmt.Sprintf("rule %d", i + 1), ruleValues, alertRuleSchema)...)
+		}
+		if len(errs) > 0 {
+			return errors.New(strings.Join(errs, ", "))
+		}
+		valid = true
+	}
+	if !valid {
+		return fmt.Errorf("expected %s, got %v (%T)", kind, value, value)
+	}
+	return nil
+}
+
+// The keys with dots (e.g. rabbit@node.example.com) are nested tables for viper
+func isStringTable(value interface{}) bool {
+	table, ok := value.(map[string]interface{})
+	if !ok { return false }
+	for _, item := range table {
+		if _, ok := item.(string); !ok && !isStringTable(item) { return false }
+	}
+	return true
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch typed := m.(type) {
+	case map[string]interface{}:
+		for key := range typed {
+			keys = append(keys, key)
+		}
+	case map[string]map[string]string:
+		for key := range typed {
+			keys = append(keys, key)
+		}
+	case map[string]string:
+		for key := range typed {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Sets the flags that are not set in the command line (set) from the exporter table of the config file, the keys
+// are the names of the flags. The precedence is: command line, environment variables, config file and defaults.
+func (c *ConfigSnapshot) SetFlags(flags *flag.FlagSet, set map[string]bool) error {
+	values, ok := c.Get(ExporterTable).(map[string]interface{})
+	if !ok {
+		if c.IsSet(ExporterTable) {
+			return fmt.Errorf("%s must be a table", ExporterTable)
+		}
+		return nil
+	}
+	var errs []string
+	for _, name := range sortedKeys(values) {
+		f := flags.Lookup(name)
+		if f == nil || name == "config_file" {
+			errs = append(errs, fmt.Sprintf("unknown key %s.%s, the keys are the flags of the exporter (see -help)", ExporterTable, name))
+			continue
+		}
+		if set[name] { continue }
+		if err := flags.Set(name, flagValue(values[name])); err != nil {
+			errs = append(errs, fmt.Sprintf("%s.%s: %v", ExporterTable, name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Value of a flag in the exporter table of the config file, for the commands that only read some of the flags of
+// the exporter (e.g. generate) and can't use SetFlags
+func (c *ConfigSnapshot) ExporterFlag(name string) (string, bool) {
+	values, ok := c.Get(ExporterTable).(map[string]interface{})
+	if !ok { return "", false }
+	value, ok := values[name]
+	if !ok { return "", false }
+	return flagValue(value), true
+}
+
+// Lists are joined with spaces, as the flags with several values (e.g. -rabbitmqctl_args)
+func flagValue(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, " ")
+	}
+	return fmt.Sprint(value)
+}
+
+// Sets the flags that are not set in the command line (set) from the environment variables RMQ_EXPORTER_<FLAG>,
+// e.g. RMQ_EXPORTER_QUEUE_PARSER for -queue_parser. The flags set are added to set.
+func SetFlagsFromEnv(flags *flag.FlagSet, set map[string]bool) error {
+	var errs []string
+	flags.VisitAll(func(f *flag.Flag) {
+		if set[f.Name] { return }
+		name := EnvPrefix + strings.ToUpper(f.Name)
+		value, ok := os.LookupEnv(name)
+		if !ok { return }
+		if err := flags.Set(f.Name, value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			return
+		}
+		set[f.Name] = true
+	})
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Flags with secrets, -create_config only writes them to the config file when they are set in the command line
+var secretFlags = map[string]bool{"erlang_cookie": true}
+
+// Flags of set that are written to the exporter table of a new config file, sorted. The secrets of the environment
+// variables are left out, the environment is often shared (e.g. CI) and the file isn't expected to contain them.
+func ConfigFileFlagNames(set map[string]bool, commandLine map[string]bool) []string {
+	var names []string
+	for name := range set {
+		if secretFlags[name] && !commandLine[name] { continue }
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Flags set in the command line
+func SetFlagNames(flags *flag.FlagSet) map[string]bool {
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return set
+}
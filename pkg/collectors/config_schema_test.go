@@ -0,0 +1,152 @@
+package collectors
+
+import (
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestValidateSchema(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	writeConfig(t, configPath, `
+[exporter]
+port = 2113
+[filters]
+queues = ['^amq\.']
+[pushgateway]
+url = "http://localhost:9091"
+retry_delay = "2s"
+grouping = { instance = "rabbit" }
+[probe.erlang_cookies]
+"rabbit@node.example.com" = "secret"
+[[alerting.rules]]
+name = "backlog"
+condition = "messages > 10"
+for = "5m"
+`)
+	_, err := NewConfig(configPath)
+	assert.Nil(t, err)
+
+	writeConfig(t, configPath, "[filter]\nqueues = ['^amq']\n")
+	_, err = NewConfig(configPath)
+	assert.EqualError(t, err, "unknown table [filter], the tables are: alerting, dogstatsd, executor, filters, influxdb, management, otlp, probe, pushgateway, rabbitmqctl, remote_write")
+
+	writeConfig(t, configPath, "[filters]\nqueue = ['^amq']\n")
+	_, err = NewConfig(configPath)
+	assert.EqualError(t, err, "unknown key filters.queue, the keys of [filters] are: queues")
+
+	writeConfig(t, configPath, "[rabbitmqctl]\ntimeout = '10'\nquiet = 1\n[pushgateway]\nretry_delay = 2\n[remote_write]\ntimeout = 'soon'\n")
+	_, err = NewConfig(configPath)
+	assert.EqualError(t, err, "pushgateway.retry_delay: expected duration, got 2 (int64); "+
+		"rabbitmqctl.quiet: expected boolean, got 1 (int64); rabbitmqctl.timeout: expected integer, got 10 (string); "+
+		"remote_write.timeout: invalid duration \"soon\", e.g. 30s, 5m or 1h")
+
+	writeConfig(t, configPath, "[[alerting.rules]]\nname = 'backlog'\nthreshold = 10\n")
+	_, err = NewConfig(configPath)
+	assert.EqualError(t, err, "alerting.rules: unknown key rule 1.threshold, the keys of [rule 1] are: condition, for, name, queue_regex")
+}
+
+func newTestFlags() (*flag.FlagSet, *int, *string, *time.Duration) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	port := flags.Int("port", 2112, "")
+	args := flags.String("rabbitmqctl_args", "", "")
+	interval := flags.Duration("push_interval", time.Minute, "")
+	flags.String("config_file", "", "")
+	return flags, port, args, interval
+}
+
+func TestSetFlags(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	writeConfig(t, configPath, "[exporter]\nport = 2113\nrabbitmqctl_args = ['--vhost', 'test']\npush_interval = '30s'\n")
+	config, err := NewConfig(configPath)
+	assert.Nil(t, err)
+
+	// The command line has precedence over the config file
+	flags, port, args, interval := newTestFlags()
+	assert.Nil(t, flags.Parse([]string{"-port", "2114"}))
+	assert.Nil(t, config.Snapshot().SetFlags(flags, SetFlagNames(flags)))
+	assert.Equal(t, 2114, *port)
+	assert.Equal(t, "--vhost test", *args)
+	assert.Equal(t, 30 * time.Second, *interval)
+
+	writeConfig(t, configPath, "[exporter]\nport = 'http'\nunknown = 1\nconfig_file = 'other.toml'\n")
+	config, err = NewConfig(configPath)
+	assert.Nil(t, err)
+	flags, _, _, _ = newTestFlags()
+	err = config.Snapshot().SetFlags(flags, SetFlagNames(flags))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown key exporter.config_file")
+	assert.Contains(t, err.Error(), "exporter.port: parse error")
+	assert.Contains(t, err.Error(), "unknown key exporter.unknown")
+}
+
+func TestSetFlagsFromEnv(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	writeConfig(t, configPath, "[exporter]\nport = 2113\npush_interval = '30s'\n")
+	config, err := NewConfig(configPath)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Setenv("RMQ_EXPORTER_PORT", "2115"))
+	assert.Nil(t, os.Setenv("RMQ_EXPORTER_RABBITMQCTL_ARGS", "--vhost env"))
+	defer os.Unsetenv("RMQ_EXPORTER_PORT")
+	defer os.Unsetenv("RMQ_EXPORTER_RABBITMQCTL_ARGS")
+
+	// Command line, environment variables and config file
+	flags, port, args, interval := newTestFlags()
+	assert.Nil(t, flags.Parse([]string{"-rabbitmqctl_args", "--vhost cli"}))
+	set := SetFlagNames(flags)
+	assert.Nil(t, SetFlagsFromEnv(flags, set))
+	assert.Nil(t, config.Snapshot().SetFlags(flags, set))
+	assert.Equal(t, 2115, *port)
+	assert.Equal(t, "--vhost cli", *args)
+	assert.Equal(t, 30 * time.Second, *interval)
+
+	assert.Nil(t, os.Setenv("RMQ_EXPORTER_PORT", "http"))
+	flags, _, _, _ = newTestFlags()
+	err = SetFlagsFromEnv(flags, SetFlagNames(flags))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "RMQ_EXPORTER_PORT: parse error")
+}
+
+func TestConfigFileFlagNames(t *testing.T) {
+	assert.Nil(t, os.Setenv("RMQ_EXPORTER_ERLANG_COOKIE", "secret"))
+	assert.Nil(t, os.Setenv("RMQ_EXPORTER_PORT", "2115"))
+	defer os.Unsetenv("RMQ_EXPORTER_ERLANG_COOKIE")
+	defer os.Unsetenv("RMQ_EXPORTER_PORT")
+
+	// The cookie of the environment is not written
+	flags, _, _, _ := newTestFlags()
+	cookie := flags.String("erlang_cookie", "", "")
+	assert.Nil(t, flags.Parse([]string{"-rabbitmqctl_args", "--vhost cli"}))
+	commandLine := SetFlagNames(flags)
+	set := SetFlagNames(flags)
+	assert.Nil(t, SetFlagsFromEnv(flags, set))
+	assert.Equal(t, "secret", *cookie)
+	assert.Equal(t, []string{"port", "rabbitmqctl_args"}, ConfigFileFlagNames(set, commandLine))
+
+	// Unless it's in the command line
+	flags, _, _, _ = newTestFlags()
+	flags.String("erlang_cookie", "", "")
+	assert.Nil(t, flags.Parse([]string{"-erlang_cookie", "cli"}))
+	commandLine = SetFlagNames(flags)
+	set = SetFlagNames(flags)
+	assert.Nil(t, SetFlagsFromEnv(flags, set))
+	assert.Equal(t, []string{"erlang_cookie", "port"}, ConfigFileFlagNames(set, commandLine))
+}
+
+func TestExporterFlag(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	writeConfig(t, configPath, "[exporter]\nprefix = 'test_'\nrabbitmqctl_args = ['--vhost', 'test']\n")
+	config, err := NewConfig(configPath)
+	assert.Nil(t, err)
+
+	value, ok := config.Snapshot().ExporterFlag("prefix")
+	assert.True(t, ok)
+	assert.Equal(t, "test_", value)
+	value, _ = config.Snapshot().ExporterFlag("rabbitmqctl_args")
+	assert.Equal(t, "--vhost test", value)
+	_, ok = config.Snapshot().ExporterFlag("port")
+	assert.False(t, ok)
+}
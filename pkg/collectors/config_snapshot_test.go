@@ -0,0 +1,143 @@
+package collectors
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+)
+
+const (
+	devQueuesConfig	= "[filters]\nqueues = ['^.*\\.dev$']\n"
+	q3QueuesConfig	= "[filters]\nqueues = ['^q3$']\n"
+)
+
+// Calls afterLine after the parser has received every line, the output channel is not buffered
+type callbackLinesExecutor struct {
+	outputCh	chan string
+	output		[]string
+	afterLine	func(int)
+}
+
+func (e *callbackLinesExecutor) Output() <-chan string {
+	return e.outputCh
+}
+
+func (e *callbackLinesExecutor) Execute(ctx context.Context) error {
+	defer close(e.outputCh)
+	for i, line := range e.output {
+		select {
+		case e.outputCh <- line:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		e.afterLine(i)
+	}
+	return nil
+}
+
+type callbackLinesExecutorFactory struct {
+	afterLine	func(int)
+}
+
+func (f *callbackLinesExecutorFactory) NewExecutor(command string, arguments []string, outputBuffer int) IExecutor {
+	return &callbackLinesExecutor{
+		outputCh: make(chan string),
+		output: []string{
+			`Listing queues for vhost / ...`,
+			`[[{name,<<"q1.dev">>},{state,running},{messages_ready,1}],`,
+			` [{name,<<"q2.dev">>},`,
+			`  {state,running},{messages_ready,2}],[{name,<<"q3">>},{state,running},{messages_ready,3}]]`,
+		},
+		afterLine: f.afterLine,
+	}
+}
+
+func collectedQueues(t *testing.T, collector *CmdCollector) []string {
+	results, err := collector.Collect()
+	assert.Nil(t, err)
+	var queues []string
+	for _, result := range results {
+		labels, err := result.GetLabels("messages_ready")
+		if err == nil {
+			queues = append(queues, labels["queue"])
+		}
+	}
+	sort.Strings(queues)
+	return queues
+}
+
+func newTestConfig(t *testing.T, content string) (*Config, string) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	writeConfig(t, configPath, content)
+	config, err := NewConfig(configPath)
+	assert.Nil(t, err)
+	return config, configPath
+}
+
+// The config is reloaded in the middle of the collection, after the first queue has been parsed
+func TestReloadDuringCollection(t *testing.T) {
+	config, configPath := newTestConfig(t, devQueuesConfig)
+	factory := &callbackLinesExecutorFactory{afterLine: func(line int) {
+		if line == 1 {
+			writeConfig(t, configPath, q3QueuesConfig)
+			assert.Nil(t, config.Reload())
+		}
+	}}
+	collector := NewCmdCollector(NewQueueErlangParser(config), factory, 1000000, 1000000)
+	assert.Equal(t, []string{"q1.dev", "q2.dev"}, collectedQueues(t, collector))
+
+	// The next collection uses the new config
+	factory.afterLine = func(int) {}
+	assert.Equal(t, []string{"q3"}, collectedQueues(t, collector))
+}
+
+// Run with -race: the collections run while the config is reloaded and every one of them uses one of the configs
+func TestConcurrentReloads(t *testing.T) {
+	config, _ := newTestConfig(t, devQueuesConfig)
+	devSnapshot := config.Snapshot()
+	_, q3ConfigPath := newTestConfig(t, q3QueuesConfig)
+	q3Config, _ := NewConfig(q3ConfigPath)
+	q3Snapshot := q3Config.Snapshot()
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			snapshot := devSnapshot
+			if i % 2 == 0 {
+				snapshot = q3Snapshot
+			}
+			config.current.Store(snapshot)
+		}
+	}()
+
+	var collections sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		collections.Add(1)
+		go func() {
+			defer collections.Done()
+			collector := NewCmdCollector(NewQueueErlangParser(config), &callbackLinesExecutorFactory{afterLine: func(int) {}}, 1000000, 1000000)
+			for j := 0; j < 50; j++ {
+				queues := collectedQueues(t, collector)
+				if len(queues) == 1 {
+					assert.Equal(t, []string{"q3"}, queues)
+				} else {
+					assert.Equal(t, []string{"q1.dev", "q2.dev"}, queues)
+				}
+			}
+		}()
+	}
+	collections.Wait()
+	close(done)
+	wg.Wait()
+}
@@ -1,12 +1,14 @@
 package collectors
 
 import (
-	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	_ "github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"os"
+	"rmq-console-exporter/pkg/exporters"
 	"testing"
+	"time"
 )
 
 func TestInit(t *testing.T) {
@@ -16,18 +18,17 @@ func TestInit(t *testing.T) {
 	WriteDummyConfig(configPath, payload)
 
 	config, _ := NewConfig(configPath)
-	config.OnConfigChange(func(e fsnotify.Event) {
-		config.Init()
-	})
-	config.WatchConfig()
-
 	assert.Equal(t, true, config.filterQueue("object_test.dev"))
 
 	// Change the config file and write the new config
 	payload = []string{`^.*\.super\..*$`}
 	WriteDummyConfig(configPath, payload)
 
+	// The snapshots taken before the reload keep the previous config
+	snapshot := config.Snapshot()
+	assert.Nil(t, config.Reload())
 	assert.Equal(t, false, config.filterQueue("object_test.dev"))
+	assert.Equal(t, true, snapshot.filterQueue("object_test.dev"))
 
 	os.Remove(configPath)
 }
@@ -37,6 +38,58 @@ func TestEmpty(t *testing.T) {
 	assert.Equal(t, true, config.filterQueue("object_test.dev"))
 }
 
+func TestGetAlertOptions(t *testing.T) {
+	configPath := "./tests_alerts_config.toml"
+	content := `
+[alerting]
+webhook_url = "http://127.0.0.1:5001/hook"
+retries = 2
+
+[[alerting.rules]]
+name = "backlog"
+queue_regex = "^orders\\."
+condition = "messages_ready > 10000"
+for = "5m"
+
+[[alerting.rules]]
+condition = "consumers == 0 and messages_ready > 0"
+`
+	assert.Nil(t, ioutil.WriteFile(configPath, []byte(content), 0644))
+	defer os.Remove(configPath)
+
+	config, err := NewConfig(configPath)
+	assert.Nil(t, err)
+	options, err := config.Snapshot().GetAlertOptions()
+	assert.Nil(t, err)
+	assert.Equal(t, "http://127.0.0.1:5001/hook", options.WebhookURL)
+	assert.Equal(t, 2, options.Retries)
+	assert.Equal(t, time.Second, options.RetryDelay)
+	assert.Equal(t, []exporters.AlertRule{
+		{Name: "backlog", QueueRegex: `^orders\.`, Condition: "messages_ready > 10000", For: 5 * time.Minute},
+		{Condition: "consumers == 0 and messages_ready > 0"},
+	}, options.Rules)
+}
+
+func TestGetDogStatsDOptions(t *testing.T) {
+	configPath := "./tests_dogstatsd_config.toml"
+	assert.Nil(t, ioutil.WriteFile(configPath, []byte("[dogstatsd]\naddress = \"127.0.0.1:8125\"\n"), 0644))
+	defer os.Remove(configPath)
+
+	// The prefix of the exporter by default
+	config, err := NewConfig(configPath)
+	assert.Nil(t, err)
+	options := config.Snapshot().GetDogStatsDOptions("rmq_")
+	assert.Equal(t, "rmq_", options.Prefix)
+	assert.Equal(t, "rmq_", options.ExporterPrefix)
+
+	// An empty prefix removes it
+	assert.Nil(t, ioutil.WriteFile(configPath, []byte("[dogstatsd]\naddress = \"127.0.0.1:8125\"\nprefix = \"\"\n"), 0644))
+	config, err = NewConfig(configPath)
+	assert.Nil(t, err)
+	options = config.Snapshot().GetDogStatsDOptions("rmq_")
+	assert.Equal(t, "", options.Prefix)
+}
+
 func WriteDummyConfig(configPath string, payload []string) {
 	viper.Set("filters", map[string][]string{})
 	viper.Set("filters.queues", payload)
@@ -0,0 +1,75 @@
+package collectors
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+const defaultCtlCmd = "rabbitmqctl"
+
+// Global options of the RMQ CLI tools, they are applied to the command of every parser
+type CtlOptions struct {
+	Path			string
+	Node			string
+	LongNames		bool
+	ErlangCookie	string
+	TimeoutSec		int
+	Quiet			bool
+	Arguments		[]string
+}
+
+// The path replaces rabbitmqctl, the other CLI tools (e.g. rabbitmq-diagnostics) are expected in the same directory
+func (o CtlOptions) GetCmd(cmd string) string {
+	if o.Path == "" {
+		return cmd
+	}
+	if cmd == defaultCtlCmd {
+		return o.Path
+	}
+	if dir := filepath.Dir(o.Path); dir != "." {
+		return filepath.Join(dir, cmd)
+	}
+	return cmd
+}
+
+// The global options must go before the command (e.g. rabbitmqctl -n node -q list_queues ...)
+func (o CtlOptions) GetArguments() []string {
+	var arguments []string
+	if o.Node != "" {
+		arguments = append(arguments, "-n", o.Node)
+	}
+	if o.LongNames {
+		arguments = append(arguments, "--longnames")
+	}
+	if o.ErlangCookie != "" {
+		arguments = append(arguments, "--erlang-cookie", o.ErlangCookie)
+	}
+	if o.TimeoutSec > 0 {
+		arguments = append(arguments, "-t", strconv.Itoa(o.TimeoutSec))
+	}
+	if o.Quiet {
+		arguments = append(arguments, "-q")
+	}
+	return append(arguments, o.Arguments...)
+}
+
+func (o CtlOptions) Validate() error {
+	if o.Node != "" && !validNode.MatchString(o.Node) {
+		return fmt.Errorf("invalid node name %q", o.Node)
+	}
+	if o.TimeoutSec < 0 {
+		return fmt.Errorf("invalid timeout %d", o.TimeoutSec)
+	}
+	return nil
+}
+
+// Only useful when the commands run locally
+func (o CtlOptions) CheckCmd() error {
+	cmd := o.GetCmd(defaultCtlCmd)
+	if _, err := exec.LookPath(cmd); err != nil {
+		return fmt.Errorf("%s not found: %v", cmd, err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package collectors
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+func TestCtlOptionsArguments(t *testing.T) {
+	options := CtlOptions{
+		Node: "rabbit@node1.example.com",
+		LongNames: true,
+		ErlangCookie: "cookie",
+		TimeoutSec: 60,
+		Quiet: true,
+		Arguments: []string{"--no-table-headers"},
+	}
+	expected := []string{
+		"-n", "rabbit@node1.example.com", "--longnames", "--erlang-cookie", "cookie", "-t", "60", "-q", "--no-table-headers",
+	}
+	assert.Equal(t, expected, options.GetArguments())
+	assert.Nil(t, options.Validate())
+	assert.Equal(t, 0, len(CtlOptions{}.GetArguments()))
+
+	options.Node = "-q"
+	assert.NotNil(t, options.Validate())
+}
+
+func TestCtlOptionsCmd(t *testing.T) {
+	assert.Equal(t, "rabbitmqctl", CtlOptions{}.GetCmd("rabbitmqctl"))
+	assert.Equal(t, "/opt/rabbitmq/sbin/rabbitmqctl", CtlOptions{Path: "/opt/rabbitmq/sbin/rabbitmqctl"}.GetCmd("rabbitmqctl"))
+	assert.Equal(t, "/opt/rabbitmq/sbin/rabbitmq-diagnostics",
+		CtlOptions{Path: "/opt/rabbitmq/sbin/rabbitmqctl"}.GetCmd("rabbitmq-diagnostics"))
+	assert.Equal(t, "rabbitmq-diagnostics", CtlOptions{Path: "rabbitmqctl-3.8"}.GetCmd("rabbitmq-diagnostics"))
+
+	assert.NotNil(t, CtlOptions{Path: "./not-a-rabbitmqctl"}.CheckCmd())
+}
+
+func TestConfigCtlOptions(t *testing.T) {
+	configPath := "./tests_ctl_config.toml"
+	payload := `
+[rabbitmqctl]
+path = "/usr/sbin/rabbitmqctl"
+node = "rabbit@node1"
+timeout = 30
+quiet = true
+arguments = ["--no-table-headers"]
+`
+	assert.Nil(t, os.WriteFile(configPath, []byte(payload), 0644))
+	defer os.Remove(configPath)
+
+	config, err := NewConfig(configPath)
+	assert.Nil(t, err)
+	expected := CtlOptions{
+		Path: "/usr/sbin/rabbitmqctl",
+		Node: "rabbit@node1",
+		TimeoutSec: 30,
+		Quiet: true,
+		Arguments: []string{"--no-table-headers"},
+	}
+	assert.Equal(t, expected, config.Snapshot().GetCtlOptions())
+}
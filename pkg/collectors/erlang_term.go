@@ -0,0 +1,321 @@
+package collectors
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Minimal parser of the Erlang terms printed by the RMQ CLI tools (~p format).
+// Numbers are parsed as float64, binaries and strings as string, atoms as ErlangAtom, tuples as ErlangTuple
+// and lists as []interface{}. Pids, refs and funs are kept as the string printed.
+type ErlangAtom string
+
+type ErlangTuple []interface{}
+
+func (t ErlangTuple) String() string {
+	elements := make([]string, len(t))
+	for i, element := range t {
+		elements[i] = formatErlangTerm(element)
+	}
+	return "{" + strings.Join(elements, ",") + "}"
+}
+
+func formatErlangTerm(term interface{}) string {
+	switch v := term.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case ErlangAtom:
+		return string(v)
+	case string:
+		return v
+	case ErlangTuple:
+		return v.String()
+	case []interface{}:
+		elements := make([]string, len(v))
+		for i, element := range v {
+			elements[i] = formatErlangTerm(element)
+		}
+		return "[" + strings.Join(elements, ",") + "]"
+	}
+	return fmt.Sprintf("%v", term)
+}
+
+func ParseErlangTerm(text string) (interface{}, error) {
+	parser := &erlangTermParser{text: text}
+	term, err := parser.parseTerm()
+	if err != nil { return nil, err }
+	parser.skipSpaces()
+	if parser.pos < len(parser.text) && parser.text[parser.pos] != '.' {
+		return nil, parser.errorf("unexpected %q after the term", parser.text[parser.pos:])
+	}
+	return term, nil
+}
+
+type erlangTermParser struct {
+	text	string
+	pos		int
+}
+
+func (p *erlangTermParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid Erlang term at position %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *erlangTermParser) skipSpaces() {
+	for p.pos < len(p.text) && strings.ContainsRune(" \t\r\n", rune(p.text[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *erlangTermParser) consume(prefix string) bool {
+	p.skipSpaces()
+	if strings.HasPrefix(p.text[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+func (p *erlangTermParser) parseTerm() (interface{}, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.text) {
+		return nil, p.errorf("unexpected end of the term")
+	}
+	switch c := p.text[p.pos]; {
+	case c == '[':
+		p.pos++
+		elements, err := p.parseElements("]")
+		return elements, err
+	case c == '{':
+		p.pos++
+		elements, err := p.parseElements("}")
+		return ErlangTuple(elements), err
+	case strings.HasPrefix(p.text[p.pos:], "<<"):
+		p.pos += 2
+		return p.parseBinary()
+	case c == '<' || c == '#':
+		return p.parseOpaque()
+	case c == '"':
+		chars, err := p.parseQuoted('"')
+		return string(chars), err
+	case c == '\'':
+		chars, err := p.parseQuoted('\'')
+		return ErlangAtom(chars), err
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseNumber()
+	case c >= 'a' && c <= 'z':
+		start := p.pos
+		for p.pos < len(p.text) && isAtomChar(p.text[p.pos]) {
+			p.pos++
+		}
+		return ErlangAtom(p.text[start:p.pos]), nil
+	}
+	return nil, p.errorf("unexpected %q", p.text[p.pos])
+}
+
+func isAtomChar(c byte) bool {
+	return c == '_' || c == '@' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *erlangTermParser) parseElements(end string) ([]interface{}, error) {
+	elements := []interface{}{}
+	if p.consume(end) {
+		return elements, nil
+	}
+	for {
+		element, err := p.parseTerm()
+		if err != nil { return nil, err }
+		elements = append(elements, element)
+		if p.consume(",") { continue }
+		// Improper lists ([a|b]) are not printed by the CLI tools
+		if p.consume(end) {
+			return elements, nil
+		}
+		return nil, p.errorf("expected , or %s", end)
+	}
+}
+
+// <<"text">>, <<"text"/utf8>> or <<1,2,3>>
+func (p *erlangTermParser) parseBinary() (interface{}, error) {
+	if p.consume(">>") {
+		return "", nil
+	}
+	p.skipSpaces()
+	if p.pos < len(p.text) && p.text[p.pos] == '"' {
+		chars, err := p.parseQuoted('"')
+		if err != nil { return nil, err }
+		var text string
+		if p.consume("/utf8") {
+			text = string(chars)
+		} else {
+			text = bytesToString(chars)
+		}
+		if !p.consume(">>") {
+			return nil, p.errorf("expected >>")
+		}
+		return text, nil
+	}
+
+	var bytes []rune
+	for {
+		p.skipSpaces()
+		start := p.pos
+		for p.pos < len(p.text) && p.text[p.pos] >= '0' && p.text[p.pos] <= '9' {
+			p.pos++
+		}
+		value, err := strconv.Atoi(p.text[start:p.pos])
+		if err != nil || value > 255 { return nil, p.errorf("invalid byte in binary") }
+		bytes = append(bytes, rune(value))
+		if p.consume(",") { continue }
+		if p.consume(">>") {
+			return bytesToString(bytes), nil
+		}
+		return nil, p.errorf("expected , or >>")
+	}
+}
+
+// Binaries without /utf8 have one char per byte, they are usually UTF-8 encoded
+func bytesToString(chars []rune) string {
+	bytes := make([]byte, len(chars))
+	for i, char := range chars {
+		bytes[i] = byte(char)
+	}
+	if utf8.Valid(bytes) {
+		return string(bytes)
+	}
+	return string(chars)
+}
+
+// Pids (<0.1.0>), refs (#Ref<0.1.2.3>) and funs (#Fun<m.f.1>) are kept as strings
+func (p *erlangTermParser) parseOpaque() (interface{}, error) {
+	end := strings.IndexByte(p.text[p.pos:], '>')
+	if end < 0 {
+		return nil, p.errorf("expected >")
+	}
+	opaque := p.text[p.pos:p.pos + end + 1]
+	p.pos += end + 1
+	return opaque, nil
+}
+
+func (p *erlangTermParser) parseNumber() (interface{}, error) {
+	start := p.pos
+	p.pos++
+	for p.pos < len(p.text) && strings.ContainsRune("0123456789.eE+-#", rune(p.text[p.pos])) {
+		// The sign is only valid after the exponent
+		c := p.text[p.pos]
+		if (c == '-' || c == '+') && !strings.ContainsRune("eE", rune(p.text[p.pos - 1])) {
+			break
+		}
+		p.pos++
+	}
+	number := p.text[start:p.pos]
+	// Integers with base (16#ff)
+	if parts := strings.SplitN(number, "#", 2); len(parts) == 2 {
+		base, err := strconv.Atoi(parts[0])
+		if err != nil { return nil, p.errorf("invalid number %s", number) }
+		value, err := strconv.ParseInt(parts[1], base, 64)
+		if err != nil { return nil, p.errorf("invalid number %s", number) }
+		return float64(value), nil
+	}
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil { return nil, p.errorf("invalid number %s", number) }
+	return value, nil
+}
+
+// Quoted strings and atoms with the escape sequences of Erlang (\n, \t, \\, octal \303 and hex \xc3 or \x{e9})
+func (p *erlangTermParser) parseQuoted(quote byte) ([]rune, error) {
+	p.pos++
+	var chars []rune
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		if c == quote {
+			p.pos++
+			return chars, nil
+		}
+		if c != '\\' {
+			char, size := utf8.DecodeRuneInString(p.text[p.pos:])
+			chars = append(chars, char)
+			p.pos += size
+			continue
+		}
+
+		p.pos++
+		if p.pos >= len(p.text) { break }
+		escaped := p.text[p.pos]
+		switch {
+		case escaped >= '0' && escaped <= '7':
+			start := p.pos
+			for p.pos < len(p.text) && p.pos - start < 3 && p.text[p.pos] >= '0' && p.text[p.pos] <= '7' {
+				p.pos++
+			}
+			value, _ := strconv.ParseInt(p.text[start:p.pos], 8, 32)
+			chars = append(chars, rune(value))
+		case escaped == 'x':
+			p.pos++
+			var hex string
+			if p.pos < len(p.text) && p.text[p.pos] == '{' {
+				end := strings.IndexByte(p.text[p.pos:], '}')
+				if end < 0 { return nil, p.errorf("expected }") }
+				hex = p.text[p.pos + 1:p.pos + end]
+				p.pos += end + 1
+			} else if p.pos + 2 <= len(p.text) {
+				hex = p.text[p.pos:p.pos + 2]
+				p.pos += 2
+			}
+			value, err := strconv.ParseInt(hex, 16, 32)
+			if err != nil { return nil, p.errorf("invalid escape \\x%s", hex) }
+			chars = append(chars, rune(value))
+		default:
+			chars = append(chars, unescapeChar(escaped))
+			p.pos++
+		}
+	}
+	return nil, p.errorf("missing closing %c", quote)
+}
+
+func unescapeChar(escaped byte) rune {
+	switch escaped {
+	case 'n':
+		return '\n'
+	case 't':
+		return '\t'
+	case 'r':
+		return '\r'
+	case 's':
+		return ' '
+	case 'e':
+		return 27
+	case 'd':
+		return 127
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	case 'v':
+		return '\v'
+	}
+	return rune(escaped)
+}
+
+// Quotes a string as an Erlang binary, used to build the expressions for rabbitmqctl eval
+func erlangBinary(text string) string {
+	var quoted strings.Builder
+	quoted.WriteString(`<<"`)
+	for _, char := range text {
+		switch {
+		case char == '"' || char == '\\':
+			quoted.WriteRune('\\')
+			quoted.WriteRune(char)
+		case char > unicode.MaxASCII || !unicode.IsPrint(char):
+			for _, b := range []byte(string(char)) {
+				quoted.WriteString(fmt.Sprintf("\\%03o", b))
+			}
+		default:
+			quoted.WriteRune(char)
+		}
+	}
+	quoted.WriteString(`">>`)
+	return quoted.String()
+}
@@ -0,0 +1,53 @@
+package collectors
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseErlangTerm(t *testing.T) {
+	term, err := ParseErlangTerm(`[{name,<<"q1">>},{state,{syncing, 5}},{memory,34788},{consumer_utilisation,1.0e-1},` +
+		`{head_message_timestamp,''},{pid,<0.123.0>},{args,[]},{bin,<<>>},{bytes,<<99,97,102,195,169>>}].`)
+	assert.Nil(t, err)
+	expected := []interface{}{
+		ErlangTuple{ErlangAtom("name"), "q1"},
+		ErlangTuple{ErlangAtom("state"), ErlangTuple{ErlangAtom("syncing"), float64(5)}},
+		ErlangTuple{ErlangAtom("memory"), float64(34788)},
+		ErlangTuple{ErlangAtom("consumer_utilisation"), 0.1},
+		ErlangTuple{ErlangAtom("head_message_timestamp"), ErlangAtom("")},
+		ErlangTuple{ErlangAtom("pid"), "<0.123.0>"},
+		ErlangTuple{ErlangAtom("args"), []interface{}{}},
+		ErlangTuple{ErlangAtom("bin"), ""},
+		ErlangTuple{ErlangAtom("bytes"), "café"},
+	}
+	assert.Equal(t, expected, term)
+	assert.Equal(t, "{syncing,5}", formatErlangTerm(expected[1].(ErlangTuple)[1]))
+}
+
+func TestParseErlangEscapes(t *testing.T) {
+	term, err := ParseErlangTerm(`<<"tab\tquote\"caf\303\251">>`)
+	assert.Nil(t, err)
+	assert.Equal(t, "tab\tquote\"café", term)
+
+	term, err = ParseErlangTerm(`<<"caf\x{e9}"/utf8>>`)
+	assert.Nil(t, err)
+	assert.Equal(t, "café", term)
+
+	term, err = ParseErlangTerm(`'quoted atom'`)
+	assert.Nil(t, err)
+	assert.Equal(t, ErlangAtom("quoted atom"), term)
+
+	_, err = ParseErlangTerm(`[{name,<<"q1">>}`)
+	assert.NotNil(t, err)
+	_, err = ParseErlangTerm(`<<"q1`)
+	assert.NotNil(t, err)
+}
+
+func TestErlangBinary(t *testing.T) {
+	assert.Equal(t, `<<"/">>`, erlangBinary("/"))
+	assert.Equal(t, `<<"a\"b\\c\303\251">>`, erlangBinary(`a"b\cé`))
+
+	term, err := ParseErlangTerm(erlangBinary("vhost \"é\""))
+	assert.Nil(t, err)
+	assert.Equal(t, "vhost \"é\"", term)
+}
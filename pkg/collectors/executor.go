@@ -35,12 +35,19 @@ func (e *Executor) Execute(ctx context.Context) error {
 	}()
 
 	options := cmd.Options{Streaming: true}
-	log.Infof("Executing %v %v", e.command, strings.Join(e.arguments, " "))
+	log.Infof("Executing %v %v", e.command, strings.Join(maskSecrets(e.arguments), " "))
 	cmd := cmd.NewCmdOptions(options, e.command, e.arguments...)
+	stdout, stderr := cmd.Stdout, cmd.Stderr
 	for {
 		select {
 		// Command has finished and the final status of the execution is received
 		case finalStatus := <-cmd.Start():
+			// The final status can arrive before all the output has been read, the channel is closed by cmd at the end
+			if stdout != nil {
+				for outputLine := range stdout {
+					e.outputCh <- outputLine
+				}
+			}
 			if finalStatus.Error == nil && finalStatus.Exit == 0 && finalStatus.Complete {
 				if status, err := e.statusToJSON(finalStatus); err == nil {
 					e.outputCh <- status
@@ -51,30 +58,56 @@ func (e *Executor) Execute(ctx context.Context) error {
 			log.Errorf("Command failed. Error: %v - Exit Code: %v", finalStatus.Error, finalStatus.Exit)
 			return finalStatus.Error
 		// Output of the command in execution
-		case outputLine := <-cmd.Stdout:
+		// The output channels are closed by cmd before the final status, a closed channel is never selected again
+		case outputLine, ok := <-stdout:
+			if !ok {
+				stdout = nil
+				continue
+			}
 			e.outputCh <- outputLine
 		// Errors on StdErr will cancel of the execution
-		case outputErr, ok := <-cmd.Stderr:
+		case outputErr, ok := <-stderr:
 			if ok {
 				log.Errorf("Command returned an error: %v", outputErr)
 				// Don't kill the command
 				// cmd.Stop()
 				// return errors.New(outputErr)
+			} else {
+				stderr = nil
 			}
 		// Context pass to the execution is cancel for any reason (timeout or external errors)
 		case <-ctx.Done():
 			cmd.Stop()
-			return fmt.Errorf("executor timeout or parser error while running [%v %v]", e.command, e.arguments)
+			return fmt.Errorf("executor timeout or parser error while running [%v %v]", e.command, maskSecrets(e.arguments))
 		}
 	}
 }
 
 func (e *Executor) statusToJSON(status cmd.Status) (string, error) {
+	return commandStatusToJSON(e.command, e.arguments, status.Runtime)
+}
+
+// Last line sent by the executors, parsed as the command_runtime metric
+func commandStatusToJSON(command string, arguments []string, runtime float64) (string, error) {
 	statusMap := map[string]interface{}{
-		"command_runtime": status.Runtime,
-		"command_executed": fmt.Sprintf("%s %s", e.command, strings.Join(e.arguments, " ")),
+		"command_runtime": runtime,
+		"command_executed": fmt.Sprintf("%s %s", command, strings.Join(maskSecrets(arguments), " ")),
 	}
 	statusByte, err := json.Marshal(statusMap)
 	if err != nil { return "", err }
 	return string(statusByte), nil
 }
+
+// The command executed is logged and exposed as a label, so the Erlang cookie can't be part of it
+func maskSecrets(arguments []string) []string {
+	masked := make([]string, len(arguments))
+	for i, argument := range arguments {
+		if i > 0 && arguments[i-1] == "--erlang-cookie" {
+			argument = "***"
+		} else if strings.HasPrefix(argument, "--erlang-cookie=") {
+			argument = "--erlang-cookie=***"
+		}
+		masked[i] = argument
+	}
+	return masked
+}
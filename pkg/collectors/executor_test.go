@@ -0,0 +1,34 @@
+package collectors
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestMaskSecrets(t *testing.T) {
+	arguments := []string{"-n", "rabbit@node1", "--erlang-cookie", "secret", "list_queues"}
+	assert.Equal(t, []string{"-n", "rabbit@node1", "--erlang-cookie", "***", "list_queues"}, maskSecrets(arguments))
+	assert.Equal(t, "secret", arguments[3])
+
+	// Form passed through -rabbitmqctl_args
+	arguments = []string{"-n", "rabbit@node1", "--erlang-cookie=secret", "list_queues"}
+	assert.Equal(t, []string{"-n", "rabbit@node1", "--erlang-cookie=***", "list_queues"}, maskSecrets(arguments))
+}
+
+func TestExecutorReadsAllTheOutput(t *testing.T) {
+	// The command ends before its output is read
+	executor := NewExecutorFactory().NewExecutor("seq", []string{"1", "5000"}, 10000)
+	assert.Nil(t, executor.Execute(context.Background()))
+
+	var lines []string
+	for line := range executor.Output() {
+		lines = append(lines, line)
+	}
+	assert.Equal(t, 5001, len(lines))
+	for i, line := range lines[:5000] {
+		assert.Equal(t, strconv.Itoa(i + 1), line)
+	}
+	assert.Contains(t, lines[5000], "command_runtime")
+}
@@ -0,0 +1,67 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"os"
+)
+
+const fileMaxLineSize = 1024 * 1024
+
+// Replays the output of a command captured in a file (or stdin with -) instead of running it, used to parse
+// the dumps of rabbitmqctl offline. The command and its arguments are ignored.
+type FileExecutorFactory struct {
+	Path	string
+	Stdin	io.Reader
+}
+
+func NewFileExecutorFactory(path string) *FileExecutorFactory {
+	return &FileExecutorFactory{
+		Path: path,
+		Stdin: os.Stdin,
+	}
+}
+
+func (f *FileExecutorFactory) NewExecutor(command string, arguments []string, outputBuffer int) IExecutor {
+	return &FileExecutor{
+		path: f.Path,
+		stdin: f.Stdin,
+		outputCh: make(chan string, outputBuffer),
+	}
+}
+
+type FileExecutor struct {
+	path		string
+	stdin		io.Reader
+	outputCh	chan string
+}
+
+func (e *FileExecutor) Output() <-chan string {
+	return e.outputCh
+}
+
+func (e *FileExecutor) Execute(ctx context.Context) error {
+	defer close(e.outputCh)
+
+	input := e.stdin
+	if e.path != "-" {
+		file, err := os.Open(e.path)
+		if err != nil { return err }
+		defer file.Close()
+		input = file
+	}
+	log.Infof("Reading command output from %s", e.path)
+
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64 * 1024), fileMaxLineSize)
+	for scanner.Scan() {
+		select {
+		case e.outputCh <- scanner.Text():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,29 @@
+package collectors
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestFileExecutorStdin(t *testing.T) {
+	factory := NewFileExecutorFactory("-")
+	factory.Stdin = strings.NewReader("Listing queues for vhost / ...\nq1\trunning\t1\nq2\trunning\t2\n")
+	console := NewCmdCollector(NewQueueTableParser(&TrueFilterConfig{}), factory, 1000000, 10)
+	results, err := console.Collect()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	value, err := results[1].GetMetricValue("messages_ready")
+	assert.Nil(t, err)
+	assert.Equal(t, float64(2), value)
+}
+
+func TestFileExecutorMissingFile(t *testing.T) {
+	executor := NewFileExecutorFactory("/nonexistent/list_queues.txt").NewExecutor("rabbitmqctl", nil, 10)
+	err := executor.Execute(context.Background())
+	assert.NotNil(t, err)
+	_, ok := <-executor.Output()
+	assert.False(t, ok)
+}
@@ -35,3 +35,23 @@ func (f *Filter) Size() int {
 	return len(f.rules)
 }
 
+
+// Config of a collection, the queue_regex of a scrape replaces the filters of the config file
+func queueConfig(config IConfig, queueFilter *Filter) IConfig {
+	if queueFilter == nil {
+		return config.snapshot()
+	}
+	return filterConfig{queueFilter}
+}
+
+type filterConfig struct {
+	filter *Filter
+}
+
+func (c filterConfig) filterQueue(name string) bool {
+	return c.filter.Filter(name)
+}
+
+func (c filterConfig) snapshot() IConfig {
+	return c
+}
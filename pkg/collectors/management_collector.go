@@ -0,0 +1,297 @@
+package collectors
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"rmq-console-exporter/pkg/exporters"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ManagementQueues	= "queues"
+	ManagementNodes		= "nodes"
+	ManagementOverview	= "overview"
+
+	defaultManagementPageSize	= 500
+)
+
+var (
+	managementQueueColumns = []string{
+		"name",
+		"vhost",
+		"state",
+		"messages_ready",
+		"message_bytes_ready",
+		"messages_unacknowledged",
+		"message_bytes_unacknowledged",
+		"memory",
+		"consumers",
+		"consumer_utilisation",
+		"head_message_timestamp",
+	}
+	managementNodeColumns = []string{
+		"name",
+		"running",
+		"mem_used",
+		"mem_limit",
+		"fd_used",
+		"fd_total",
+		"sockets_used",
+		"sockets_total",
+		"proc_used",
+		"proc_total",
+		"disk_free",
+		"disk_free_limit",
+		"uptime",
+	}
+	managementOverviewColumns = []string{
+		"cluster_name",
+		"object_totals",
+		"queue_totals",
+	}
+)
+
+// Options of the management HTTP API set in the management table of the config file
+type ManagementOptions struct {
+	URL					string
+	Username			string
+	Password			string
+	PageSize			int
+	TimeoutMs			int
+	InsecureSkipVerify	bool
+}
+
+type ManagementClient struct {
+	BaseURL		*url.URL
+	Username	string
+	Password	string
+	PageSize	int
+	HTTPClient	*http.Client
+}
+
+func NewManagementClient(options ManagementOptions) (*ManagementClient, error) {
+	if options.URL == "" {
+		return nil, fmt.Errorf("the url of the management API is required")
+	}
+	baseURL, err := url.Parse(strings.TrimSuffix(options.URL, "/"))
+	if err != nil { return nil, err }
+	pageSize := options.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultManagementPageSize
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: options.InsecureSkipVerify}
+
+	return &ManagementClient{
+		BaseURL: baseURL,
+		Username: options.Username,
+		Password: options.Password,
+		PageSize: pageSize,
+		HTTPClient: &http.Client{
+			Transport: transport,
+			Timeout: time.Duration(options.TimeoutMs) * time.Millisecond,
+		},
+	}, nil
+}
+
+type managementPage struct {
+	Items		[]map[string]interface{}	`json:"items"`
+	Page		int							`json:"page"`
+	PageCount	int							`json:"page_count"`
+}
+
+// Reads all the pages of a paginated resource (e.g. /api/queues?page=1&page_size=500&columns=...)
+func (c *ManagementClient) GetPages(path string, columns []string) ([]map[string]interface{}, error) {
+	var items []map[string]interface{}
+	for page := 1; ; page++ {
+		params := url.Values{
+			"page": {strconv.Itoa(page)},
+			"page_size": {strconv.Itoa(c.PageSize)},
+			"columns": {strings.Join(columns, ",")},
+		}
+		var result managementPage
+		if err := c.Get(path, params, &result); err != nil { return nil, err }
+		items = append(items, result.Items...)
+		if page >= result.PageCount {
+			return items, nil
+		}
+	}
+}
+
+func (c *ManagementClient) Get(path string, params url.Values, result interface{}) error {
+	// The path is already escaped (e.g. /api/queues/%2F)
+	requestURL, err := url.Parse(c.BaseURL.String() + path)
+	if err != nil { return err }
+	requestURL.RawQuery = params.Encode()
+
+	request, err := http.NewRequest(http.MethodGet, requestURL.String(), nil)
+	if err != nil { return err }
+	request.SetBasicAuth(c.Username, c.Password)
+	request.Header.Set("Accept", "application/json")
+	log.Debugf("Requesting %s", requestURL.String())
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil { return err }
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("management API returned %s for %s", response.Status, path)
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// Collects the metrics of one resource (queues, nodes or overview) from the management HTTP API.
+// The queue metrics are the same as the ones parsed by QueueJSONParser, so the source can be switched
+// without changing the dashboards.
+type ManagementCollector struct {
+	Resource	string
+	Client		*ManagementClient
+	Config		IConfig
+	// Per scrape overrides, see WithFilters
+	QueueFilter	*Filter
+	Vhost		string
+}
+
+func NewManagementCollector(resource string, client *ManagementClient, config IConfig) (*ManagementCollector, error) {
+	switch resource {
+	case ManagementQueues, ManagementNodes, ManagementOverview:
+	default:
+		return nil, fmt.Errorf("unknown management API resource %q", resource)
+	}
+	return &ManagementCollector{
+		Resource: resource,
+		Client: client,
+		Config: config,
+	}, nil
+}
+
+func (c *ManagementCollector) GetName() string {
+	return c.Resource
+}
+
+func (c *ManagementCollector) WithFilters(filters exporters.ScrapeFilters) (exporters.ICollector, error) {
+	collector := *c
+	collector.Vhost = filters.Vhost
+	if filters.QueueRegex != "" {
+		queueFilter, err := NewFilter([]string{filters.QueueRegex})
+		if err != nil { return nil, err }
+		collector.QueueFilter = queueFilter
+	}
+	return &collector, nil
+}
+
+func (c *ManagementCollector) Collect() ([]exporters.IMetrics, error) {
+	log.Infof("Starting collection of %s metrics from the management API", c.Resource)
+	start := time.Now()
+	var metrics []exporters.IMetrics
+	var path string
+	var err error
+
+	switch c.Resource {
+	case ManagementQueues:
+		path = "/api/queues"
+		if c.Vhost != "" {
+			path += "/" + url.PathEscape(c.Vhost)
+		}
+		metrics, err = c.collectQueues(path)
+	case ManagementNodes:
+		path = "/api/nodes"
+		metrics, err = c.collectNodes(path)
+	case ManagementOverview:
+		path = "/api/overview"
+		metrics, err = c.collectOverview(path)
+	}
+	if err != nil { return nil, err }
+
+	runtimeMetrics := NewMetrics()
+	runtimeLabels := map[string]string{"command_executed": "GET " + c.Client.BaseURL.Path + path}
+	runtimeMetrics.AddMetric("command_runtime", time.Since(start).Seconds(), runtimeLabels)
+	return append(metrics, *runtimeMetrics), nil
+}
+
+func (c *ManagementCollector) collectQueues(path string) ([]exporters.IMetrics, error) {
+	items, err := c.Client.GetPages(path, managementQueueColumns)
+	if err != nil { return nil, err }
+
+	// Same config for all the pages
+	parser := &QueueJSONParser{Config: queueConfig(c.Config, c.QueueFilter)}
+	var metrics []exporters.IMetrics
+	for _, item := range items {
+		_, okQueue := item["name"].(string)
+		_, okState := item["state"].(string)
+		if !okQueue || !okState { continue }
+		queueMetrics, err := parser.parseQueue(item)
+		if err != nil { return nil, err }
+		if queueMetrics != nil { metrics = append(metrics, *queueMetrics) }
+	}
+	return metrics, nil
+}
+
+func (c *ManagementCollector) collectNodes(path string) ([]exporters.IMetrics, error) {
+	var items []map[string]interface{}
+	params := url.Values{"columns": {strings.Join(managementNodeColumns, ",")}}
+	if err := c.Client.Get(path, params, &items); err != nil { return nil, err }
+
+	var metrics []exporters.IMetrics
+	for _, item := range items {
+		node, ok := item["name"].(string)
+		if !ok { continue }
+		nodeMetrics := NewMetrics()
+		labels := map[string]string{"node": node}
+		for name, value := range item {
+			if fValue, ok := toFloat(value); ok {
+				nodeMetrics.AddMetric("node_" + name, fValue, labels)
+			}
+		}
+		metrics = append(metrics, *nodeMetrics)
+	}
+	return metrics, nil
+}
+
+func (c *ManagementCollector) collectOverview(path string) ([]exporters.IMetrics, error) {
+	var overview map[string]interface{}
+	params := url.Values{"columns": {strings.Join(managementOverviewColumns, ",")}}
+	if err := c.Client.Get(path, params, &overview); err != nil { return nil, err }
+
+	clusterName, _ := overview["cluster_name"].(string)
+	labels := map[string]string{"cluster_name": clusterName}
+	overviewMetrics := NewMetrics()
+	for _, totals := range []string{"object_totals", "queue_totals"} {
+		values, ok := overview[totals].(map[string]interface{})
+		if !ok { continue }
+		for name, value := range values {
+			if fValue, ok := toFloat(value); ok {
+				overviewMetrics.AddMetric("cluster_" + name, fValue, labels)
+			}
+		}
+	}
+	return []exporters.IMetrics{*overviewMetrics}, nil
+}
+
+// Gets the name of the cluster from the overview
+func (c *ManagementCollector) DetectClusterName() (string, error) {
+	var overview map[string]interface{}
+	params := url.Values{"columns": {"cluster_name"}}
+	if err := c.Client.Get("/api/overview", params, &overview); err != nil { return "", err }
+	name, ok := overview["cluster_name"].(string)
+	if !ok || name == "" {
+		return "", fmt.Errorf("cluster name not found")
+	}
+	return name, nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case bool:
+		if v { return 1.0, true }
+		return 0.0, true
+	}
+	return 0.0, false
+}
@@ -0,0 +1,203 @@
+package collectors
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"rmq-console-exporter/pkg/exporters"
+	"strconv"
+	"testing"
+)
+
+var managementQueues = []map[string]interface{}{
+	{"name": "q1.dev", "vhost": "/", "state": "running", "messages_ready": 1, "message_bytes_ready": 288,
+		"messages_unacknowledged": 0, "message_bytes_unacknowledged": 0, "memory": 34788, "consumers": 6,
+		"head_message_timestamp": 1630920836},
+	{"name": "q2.dev", "vhost": "/", "state": "running", "messages_ready": 0, "memory": 55692, "consumers": 1, "consumer_utilisation": 1.0},
+	{"name": "q3.prod", "vhost": "/", "state": "running", "messages_ready": 7, "memory": 55692, "consumers": 0, "consumer_utilisation": nil},
+	// Same name in another vhost
+	{"name": "q1.dev", "vhost": "staging", "state": "idle", "messages_ready": 3, "memory": 12288, "consumers": 0},
+}
+
+// Paginated handler of the queues of the vhost, all the vhosts when it's empty
+func managementQueuesHandler(vhost string) http.HandlerFunc {
+	var queues []map[string]interface{}
+	for _, queue := range managementQueues {
+		if vhost == "" || queue["vhost"] == vhost { queues = append(queues, queue) }
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+		pageCount := (len(queues) + pageSize - 1) / pageSize
+		end := page * pageSize
+		if end > len(queues) { end = len(queues) }
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"items": queues[(page - 1) * pageSize:end],
+			"page": page,
+			"page_count": pageCount,
+		})
+	}
+}
+
+// Stand-in of the management API, the queues are paginated like RMQ does
+func NewTestManagementServer(t *testing.T) *httptest.Server {
+	// ServeMux would redirect /api/queues/%2F to /api/queues/
+	handlers := map[string]http.HandlerFunc{}
+	handlers["/api/queues"] = managementQueuesHandler("")
+	handlers["/api/queues/%2F"] = managementQueuesHandler("/")
+	handlers["/api/queues/staging"] = managementQueuesHandler("staging")
+	handlers["/api/nodes"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[{"name":"rabbit@node1","running":true,"mem_used":104857600,"fd_used":42,"partitions":[]}]`))
+	}
+	handlers["/api/overview"] = func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"cluster_name":"rabbit@node1","object_totals":{"queues":3,"consumers":7},` +
+			`"queue_totals":{"messages":8,"messages_details":{"rate":0.0}}}`))
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "guest" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler, ok := handlers[r.URL.EscapedPath()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		handler(w, r)
+	}))
+}
+
+func newTestManagementCollector(t *testing.T, server *httptest.Server, resource string, config IConfig) *ManagementCollector {
+	client, err := NewManagementClient(ManagementOptions{URL: server.URL, Username: "guest", Password: "secret", PageSize: 2})
+	assert.Nil(t, err)
+	collector, err := NewManagementCollector(resource, client, config)
+	assert.Nil(t, err)
+	return collector
+}
+
+func TestManagementCollectQueues(t *testing.T) {
+	server := NewTestManagementServer(t)
+	defer server.Close()
+	results, err := newTestManagementCollector(t, server, ManagementQueues, &TrueFilterConfig{}).Collect()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(results))
+
+	// Same metrics as the ones parsed from rabbitmqctl, with the vhost of the queue
+	line := `{"name":"q1.dev","vhost":"/","state":"running","messages_ready":1,"message_bytes_ready":288,` +
+		`"messages_unacknowledged":0,"message_bytes_unacknowledged":0,"memory":34788,"consumers":6,` +
+		`"head_message_timestamp":1630920836}`
+	expected, err := NewQueueJSONParser(&TrueFilterConfig{}).Parse(line)
+	assert.Nil(t, err)
+	assert.Equal(t, *expected, results[0])
+
+	_, err = results[2].GetMetricValue("consumer_utilisation")
+	assert.NotNil(t, err)
+	labels, err := results[3].GetLabels("messages_ready")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"queue": "q1.dev", "state": "idle", "vhost": "staging"}, labels)
+	labels, err = results[4].GetLabels("command_runtime")
+	assert.Nil(t, err)
+	assert.Equal(t, "GET /api/queues", labels["command_executed"])
+}
+
+func TestManagementCollectQueuesOfVhost(t *testing.T) {
+	server := NewTestManagementServer(t)
+	defer server.Close()
+	collector := newTestManagementCollector(t, server, ManagementQueues, &TrueFilterConfig{})
+	for vhost, count := range map[string]int{"/": 3, "staging": 1} {
+		filtered, err := collector.WithFilters(exporters.ScrapeFilters{Vhost: vhost})
+		assert.Nil(t, err)
+		results, err := filtered.Collect()
+		assert.Nil(t, err)
+		assert.Equal(t, count + 1, len(results))
+		labels, err := results[0].GetLabels("messages_ready")
+		assert.Nil(t, err)
+		assert.Equal(t, vhost, labels["vhost"])
+		labels, err = results[count].GetLabels("command_runtime")
+		assert.Nil(t, err)
+		assert.Equal(t, "GET /api/queues/" + url.PathEscape(vhost), labels["command_executed"])
+	}
+}
+
+func TestManagementCollectQueuesFiltered(t *testing.T) {
+	server := NewTestManagementServer(t)
+	defer server.Close()
+	collector := newTestManagementCollector(t, server, ManagementQueues, &TrueFilterConfig{})
+	filtered, err := collector.WithFilters(exporters.ScrapeFilters{QueueRegex: `^.*\.prod$`})
+	assert.Nil(t, err)
+	results, err := filtered.Collect()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	value, err := results[0].GetMetricValue("messages_ready")
+	assert.Nil(t, err)
+	assert.Equal(t, float64(7), value)
+
+	results, err = newTestManagementCollector(t, server, ManagementQueues, &FalseFilterConfig{}).Collect()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+
+	// The queue_regex replaces the filters of the config file
+	collector = newTestManagementCollector(t, server, ManagementQueues, &FalseFilterConfig{})
+	filtered, err = collector.WithFilters(exporters.ScrapeFilters{QueueRegex: `^.*\.prod$`})
+	assert.Nil(t, err)
+	results, err = filtered.Collect()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+}
+
+func TestManagementCollectNodes(t *testing.T) {
+	server := NewTestManagementServer(t)
+	defer server.Close()
+	results, err := newTestManagementCollector(t, server, ManagementNodes, &TrueFilterConfig{}).Collect()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	nodeMetrics := results[0].(Metrics)
+	checkValue(t, &nodeMetrics, "node_running", 1)
+	checkValue(t, &nodeMetrics, "node_mem_used", 104857600)
+	labels, err := nodeMetrics.GetLabels("node_fd_used")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"node": "rabbit@node1"}, labels)
+}
+
+func TestManagementCollectOverview(t *testing.T) {
+	server := NewTestManagementServer(t)
+	defer server.Close()
+	results, err := newTestManagementCollector(t, server, ManagementOverview, &TrueFilterConfig{}).Collect()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	overviewMetrics := results[0].(Metrics)
+	checkValue(t, &overviewMetrics, "cluster_queues", 3)
+	checkValue(t, &overviewMetrics, "cluster_messages", 8)
+	labels, err := overviewMetrics.GetLabels("cluster_consumers")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"cluster_name": "rabbit@node1"}, labels)
+}
+
+func TestManagementDetectClusterName(t *testing.T) {
+	server := NewTestManagementServer(t)
+	defer server.Close()
+	cluster, err := newTestManagementCollector(t, server, ManagementQueues, &TrueFilterConfig{}).DetectClusterName()
+	assert.Nil(t, err)
+	assert.Equal(t, "rabbit@node1", cluster)
+}
+
+func TestManagementUnauthorized(t *testing.T) {
+	server := NewTestManagementServer(t)
+	defer server.Close()
+	client, err := NewManagementClient(ManagementOptions{URL: server.URL, Username: "guest", Password: "guest"})
+	assert.Nil(t, err)
+	collector, err := NewManagementCollector(ManagementOverview, client, &TrueFilterConfig{})
+	assert.Nil(t, err)
+	_, err = collector.Collect()
+	assert.NotNil(t, err)
+
+	_, err = NewManagementCollector("exchanges", client, &TrueFilterConfig{})
+	assert.NotNil(t, err)
+}
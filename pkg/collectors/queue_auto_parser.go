@@ -0,0 +1,181 @@
+package collectors
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// Version printed by rabbitmqctl version (3.7+) or status: RabbitMQ version: 3.8.9 (3.8+)
+// or {rabbit,"RabbitMQ","3.6.16"} (3.6 and 3.7)
+var rabbitMQVersion = regexp.MustCompile(`(?:^\s*|RabbitMQ version: |\{rabbit,"RabbitMQ",")(\d+)\.(\d+)\.(\d+[^\s"]*)`)
+
+// Selects the queue parser supported by the version of the RMQ node, the version is detected by CmdCollector
+// before the first collection and again after a collection fails (e.g. the node has been upgraded).
+// The version is exposed in the rabbitmq_version_info metric with the command_runtime one.
+type QueueAutoParser struct {
+	Config	IConfig
+	mutex	sync.RWMutex
+	version	string
+	parser	ICmdParser
+}
+
+func NewQueueAutoParser(config IConfig) *QueueAutoParser {
+	return &QueueAutoParser{
+		Config: config,
+		parser: NewQueueJSONParser(config),
+	}
+}
+
+func (p *QueueAutoParser) GetName() string {
+	return "queues"
+}
+
+func (p *QueueAutoParser) GetCmd() string {
+	return p.getParser().GetCmd()
+}
+
+func (p *QueueAutoParser) GetArguments() []string {
+	return p.getParser().GetArguments()
+}
+
+func (p *QueueAutoParser) GetVhostArguments(vhost string) []string {
+	parser := p.getParser()
+	if vhostParser, ok := parser.(IVhostCmdParser); ok {
+		return vhostParser.GetVhostArguments(vhost)
+	}
+	arguments := parser.GetArguments()
+	return append([]string{arguments[0], "-p", vhost}, arguments[1:]...)
+}
+
+func (p *QueueAutoParser) GetVersion() string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.version
+}
+
+// RMQ 3.7+ lists the queues as JSON, older versions only have the tabular output. head_message_timestamp
+// is not available before 3.6. An empty version forces a new detection.
+func (p *QueueAutoParser) SetVersion(version string) error {
+	var parser ICmdParser
+	if version != "" {
+		major, minor, err := parseRabbitMQVersion(version)
+		if err != nil { return err }
+		switch {
+		case major > 3 || (major == 3 && minor >= 7):
+			parser = NewQueueJSONParser(p.Config)
+		case major == 3 && minor == 6:
+			parser = NewQueueTableParser(p.Config)
+		default:
+			tableParser := NewQueueTableParser(p.Config)
+			tableParser.Arguments = append([]string{"list_queues"}, queueInfoItems[:len(queueInfoItems)-1]...)
+			parser = tableParser
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.version = version
+	if parser != nil {
+		p.parser = parser
+	}
+	return nil
+}
+
+// Parsers of other nodes detect their own version
+func (p *QueueAutoParser) Undetected() IVersionedCmdParser {
+	return NewQueueAutoParser(p.Config)
+}
+
+func (p *QueueAutoParser) getParser() ICmdParser {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.parser
+}
+
+func (p *QueueAutoParser) GetConfig() IConfig {
+	return p.Config
+}
+
+// The selected parser gets the same config
+func (p *QueueAutoParser) WithConfig(config IConfig) ICmdParser {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	parser := p.parser
+	if configParser, ok := parser.(IConfigCmdParser); ok {
+		parser = configParser.WithConfig(config)
+	}
+	return &QueueAutoParser{
+		Config: config,
+		version: p.version,
+		parser: parser,
+	}
+}
+
+// Every collection uses a copy of the selected parser, so the version can change between collections
+func (p *QueueAutoParser) Copy() IMultiCmdParser {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	parser := p.parser
+	if multiParser, ok := parser.(IMultiCmdParser); ok {
+		if parserCopy, ok := multiParser.Copy().(ICmdParser); ok {
+			parser = parserCopy
+		}
+	}
+	return &QueueAutoParser{
+		Config: p.Config,
+		version: p.version,
+		parser: parser,
+	}
+}
+
+func (p *QueueAutoParser) Parse(line string) (*Metrics, error) {
+	metrics, err := p.ParseAll(line)
+	if len(metrics) == 0 {
+		return nil, err
+	}
+	return metrics[0], err
+}
+
+func (p *QueueAutoParser) ParseAll(line string) ([]*Metrics, error) {
+	var metrics []*Metrics
+	var err error
+	parser := p.getParser()
+	if multiParser, ok := parser.(IMultiCmdParser); ok {
+		metrics, err = multiParser.ParseAll(line)
+	} else {
+		var lineMetrics *Metrics
+		if lineMetrics, err = parser.Parse(line); lineMetrics != nil {
+			metrics = []*Metrics{lineMetrics}
+		}
+	}
+
+	version := p.GetVersion()
+	for _, lineMetrics := range metrics {
+		if _, err := lineMetrics.GetMetricValue("command_runtime"); err == nil && version != "" {
+			lineMetrics.AddMetric("rabbitmq_version_info", 1.0, map[string]string{"version": version})
+		}
+	}
+	return metrics, err
+}
+
+// Finds the version in the output of rabbitmqctl version or status
+func findRabbitMQVersion(lines []string) (string, error) {
+	for _, line := range lines {
+		if match := rabbitMQVersion.FindStringSubmatch(line); match != nil {
+			return match[1] + "." + match[2] + "." + match[3], nil
+		}
+	}
+	return "", fmt.Errorf("RabbitMQ version not found")
+}
+
+func parseRabbitMQVersion(version string) (int, int, error) {
+	match := rabbitMQVersion.FindStringSubmatch(version)
+	if match == nil {
+		return 0, 0, fmt.Errorf("invalid RabbitMQ version %q", version)
+	}
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+	return major, minor, nil
+}
@@ -0,0 +1,177 @@
+package collectors
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// Answers the rabbitmqctl commands with the output of the RMQ version set, the commands without output fail
+type TestVersionExecutorFactory struct {
+	outputs		map[string][]string
+	commands	[]string
+}
+
+func (f *TestVersionExecutorFactory) NewExecutor(command string, arguments []string, outputBuffer int) IExecutor {
+	cmd := ""
+	for _, argument := range arguments {
+		if _, ok := f.outputs[argument]; ok {
+			cmd = argument
+			break
+		}
+	}
+	f.commands = append(f.commands, cmd)
+	return &TestFailingLinesExecutor{
+		TestLinesExecutor: TestLinesExecutor{outputCh: make(chan string, 100), output: f.outputs[cmd]},
+		fail: cmd == "",
+	}
+}
+
+type TestFailingLinesExecutor struct {
+	TestLinesExecutor
+	fail	bool
+}
+
+func (e *TestFailingLinesExecutor) Execute(ctx context.Context) error {
+	if e.fail {
+		close(e.outputCh)
+		return errors.New("command failed")
+	}
+	return e.TestLinesExecutor.Execute(ctx)
+}
+
+func TestFindRabbitMQVersion(t *testing.T) {
+	version, err := findRabbitMQVersion([]string{"3.8.9"})
+	assert.Nil(t, err)
+	assert.Equal(t, "3.8.9", version)
+
+	version, err = findRabbitMQVersion([]string{"Status of node rabbit@host ...", "Runtime", "", "RabbitMQ version: 3.9.0-rc.1"})
+	assert.Nil(t, err)
+	assert.Equal(t, "3.9.0-rc.1", version)
+
+	version, err = findRabbitMQVersion([]string{"[{pid,1234},", ` {running_applications,[{rabbit,"RabbitMQ","3.6.16"},`})
+	assert.Nil(t, err)
+	assert.Equal(t, "3.6.16", version)
+
+	_, err = findRabbitMQVersion([]string{`{"command_executed":"rabbitmqctl status","command_runtime":0.5}`})
+	assert.NotNil(t, err)
+}
+
+func TestQueueAutoParserSetVersion(t *testing.T) {
+	parser := NewQueueAutoParser(&TrueFilterConfig{})
+	assert.Nil(t, parser.SetVersion("3.8.9"))
+	assert.IsType(t, &QueueJSONParser{}, parser.getParser())
+
+	assert.Nil(t, parser.SetVersion("3.6.16"))
+	assert.IsType(t, &QueueTableParser{}, parser.getParser())
+	assert.Contains(t, parser.GetArguments(), "head_message_timestamp")
+
+	assert.Nil(t, parser.SetVersion("3.5.7"))
+	assert.NotContains(t, parser.GetArguments(), "head_message_timestamp")
+	assert.Equal(t, []string{"list_queues", "-p", "dev", "name"}, parser.GetVhostArguments("dev")[:4])
+
+	assert.NotNil(t, parser.SetVersion("unknown"))
+	assert.Equal(t, "3.5.7", parser.GetVersion())
+
+	// The parser is kept until a new version is detected
+	assert.Nil(t, parser.SetVersion(""))
+	assert.Equal(t, "", parser.GetVersion())
+	assert.IsType(t, &QueueTableParser{}, parser.getParser())
+}
+
+func TestQueueAutoParserVersionMetric(t *testing.T) {
+	parser := NewQueueAutoParser(&TrueFilterConfig{})
+	assert.Nil(t, parser.SetVersion("3.8.9"))
+
+	metrics, err := parser.Copy().ParseAll(`{"command_executed":"rabbitmqctl list_queues","command_runtime":0.5}`)
+	assert.Nil(t, err)
+	checkValue(t, metrics[0], "rabbitmq_version_info", 1)
+	checkLabels(t, metrics[0], "rabbitmq_version_info", map[string]string{"version": "3.8.9"})
+}
+
+func TestCollectAutoParser(t *testing.T) {
+	factory := &TestVersionExecutorFactory{outputs: map[string][]string{
+		"status": {`Status of node rabbit@localhost ...`, `[{pid,27180},`, ` {running_applications,[{rabbit,"RabbitMQ","3.6.16"},`},
+		"list_queues": {"Listing queues ...", "name	state	messages_ready", "q1	running	3"},
+	}}
+	console := NewCmdCollector(NewQueueAutoParser(&TrueFilterConfig{}), factory, 1000000, 1000000)
+	results, err := console.Collect()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	value, err := results[0].GetMetricValue("messages_ready")
+	assert.Nil(t, err)
+	assert.Equal(t, float64(3), value)
+	assert.Equal(t, []string{"status", "list_queues"}, factory.commands)
+
+	// The version is only detected again after a failed collection
+	_, err = console.Collect()
+	assert.Nil(t, err)
+	assert.Equal(t, "3.6.16", console.Parser.(*QueueAutoParser).GetVersion())
+	delete(factory.outputs, "list_queues")
+	_, err = console.Collect()
+	assert.NotNil(t, err)
+	assert.Equal(t, "", console.Parser.(*QueueAutoParser).GetVersion())
+	assert.Equal(t, []string{"status", "list_queues", "list_queues", ""}, factory.commands)
+}
+
+// The version of a probed node is detected at its first probe and after a failed one
+func TestCollectAutoParserWithTarget(t *testing.T) {
+	factory := &TestVersionExecutorFactory{outputs: map[string][]string{
+		"status": {"Status of node rabbit@node2 ...", "RabbitMQ version: 3.6.16"},
+		"list_queues": {"Listing queues ...", "name	state	messages_ready", "q1	running	3"},
+	}}
+	console := NewCmdCollector(NewQueueAutoParser(&TrueFilterConfig{}), factory, 1000000, 1000000)
+	for i := 0; i < 2; i++ {
+		probe, err := console.WithTarget("rabbit@node2")
+		assert.Nil(t, err)
+		_, err = probe.Collect()
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, []string{"status", "list_queues", "list_queues"}, factory.commands)
+	assert.Equal(t, "", console.Parser.(*QueueAutoParser).GetVersion())
+
+	// Other targets detect their own version
+	probe, err := console.WithTarget("rabbit@node3")
+	assert.Nil(t, err)
+	delete(factory.outputs, "list_queues")
+	_, err = probe.Collect()
+	assert.NotNil(t, err)
+	probe, _ = console.WithTarget("rabbit@node3")
+	assert.Equal(t, "", probe.(*CmdCollector).Parser.(*QueueAutoParser).GetVersion())
+	probe, _ = console.WithTarget("rabbit@node2")
+	assert.Equal(t, "3.6.16", probe.(*CmdCollector).Parser.(*QueueAutoParser).GetVersion())
+}
+
+func TestDetectVersionOfTheNode(t *testing.T) {
+	// The CLI tools can be newer than the node
+	factory := &TestVersionExecutorFactory{outputs: map[string][]string{
+		"version": {"3.9.13"},
+		"status": {`Status of node rabbit@localhost ...`, `[{pid,27180},`, ` {running_applications,[{rabbit,"RabbitMQ","3.6.16"},`},
+	}}
+	console := NewCmdCollector(NewQueueAutoParser(&TrueFilterConfig{}), factory, 1000000, 1000000)
+	version, err := console.DetectVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "3.6.16", version)
+
+	// The version of the CLI tools is the last fallback
+	factory.outputs["status"] = []string{"Status of node rabbit@localhost ..."}
+	version, err = console.DetectVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, "3.9.13", version)
+
+	delete(factory.outputs, "version")
+	_, err = console.DetectVersion()
+	assert.NotNil(t, err)
+}
+
+func TestQueueAutoParserWithConfig(t *testing.T) {
+	parser := NewQueueAutoParser(&TrueFilterConfig{})
+	assert.Nil(t, parser.SetVersion("3.6.16"))
+	config := &FalseFilterConfig{}
+	configParser := parser.WithConfig(config).(*QueueAutoParser)
+	assert.Equal(t, config, configParser.GetConfig())
+	assert.Equal(t, "3.6.16", configParser.GetVersion())
+	assert.Equal(t, config, configParser.getParser().(*QueueTableParser).Config)
+	assert.Equal(t, &TrueFilterConfig{}, parser.getParser().(*QueueTableParser).Config)
+}
@@ -0,0 +1,239 @@
+package collectors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var queueInfoItems = []string{
+	"name",
+	"state",
+	"messages_ready",
+	"message_bytes_ready",
+	"messages_unacknowledged",
+	"message_bytes_unacknowledged",
+	"memory",
+	"consumers",
+	"consumer_utilisation",
+	"head_message_timestamp",
+}
+
+// Parses the queues printed as Erlang terms, a list with one proplist per queue:
+// [[{name,<<"q1">>},{state,running},{messages_ready,0},...],
+//  [{name,<<"q2">>},...]]
+// The proplists can be split in several lines and several of them can be in the same line, so the parser
+// keeps the state between lines and CmdCollector uses ParseAll.
+type QueueErlangParser struct {
+	Config		IConfig
+	Cmd			string
+	Arguments	[]string
+	// Builds the arguments for a vhost different than the default one
+	vhostArguments	func(vhost string) []string
+	entry			strings.Builder
+	depth			int
+	quote			rune
+	escaped			bool
+}
+
+// RMQ 3.7+: rabbitmqctl list_queues --formatter erlang
+func NewQueueErlangParser(config IConfig) *QueueErlangParser {
+	return &QueueErlangParser{
+		Config: config,
+		Cmd: "rabbitmqctl",
+		Arguments: append([]string{"list_queues", "--formatter", "erlang"}, queueInfoItems...),
+	}
+}
+
+// RMQ 3.6 doesn't have formatters, the queues are listed by rabbitmqctl eval with the same info items
+func NewQueueErlangEvalParser(config IConfig) *QueueErlangParser {
+	evalArguments := func(vhost string) []string {
+		expression := fmt.Sprintf("rabbit_amqqueue:info_all(%s, [%s]).", erlangBinary(vhost), strings.Join(queueInfoItems, ","))
+		return []string{"eval", expression}
+	}
+	return &QueueErlangParser{
+		Config: config,
+		Cmd: "rabbitmqctl",
+		Arguments: evalArguments("/"),
+		vhostArguments: evalArguments,
+	}
+}
+
+func (p *QueueErlangParser) GetName() string {
+	return "queues"
+}
+
+func (p *QueueErlangParser) GetCmd() string {
+	return p.Cmd
+}
+
+func (p *QueueErlangParser) GetArguments() []string {
+	return p.Arguments
+}
+
+// rabbitmqctl eval doesn't accept -p <vhost>
+func (p *QueueErlangParser) GetVhostArguments(vhost string) []string {
+	if p.vhostArguments == nil {
+		return append([]string{p.Arguments[0], "-p", vhost}, p.Arguments[1:]...)
+	}
+	return p.vhostArguments(vhost)
+}
+
+// Every collection needs its own parser without the state of the previous lines
+func (p *QueueErlangParser) GetConfig() IConfig {
+	return p.Config
+}
+
+func (p *QueueErlangParser) WithConfig(config IConfig) ICmdParser {
+	parser := p.Copy().(*QueueErlangParser)
+	parser.Config = config
+	return parser
+}
+
+func (p *QueueErlangParser) Copy() IMultiCmdParser {
+	return &QueueErlangParser{
+		Config: p.Config,
+		Cmd: p.Cmd,
+		Arguments: p.Arguments,
+		vhostArguments: p.vhostArguments,
+	}
+}
+
+// A line can complete several queues (e.g. rabbitmqctl eval prints them on one line), it fails instead of dropping
+// them, the collectors use ParseAll
+func (p *QueueErlangParser) Parse(line string) (*Metrics, error) {
+	metrics, err := p.ParseAll(line)
+	if err != nil || len(metrics) == 0 {
+		return nil, err
+	}
+	if len(metrics) > 1 {
+		return nil, fmt.Errorf("the line completes %d queues, only one can be returned by Parse", len(metrics))
+	}
+	return metrics[0], err
+}
+
+func (p *QueueErlangParser) ParseAll(line string) ([]*Metrics, error) {
+	if p.depth == 0 {
+		trimmed := strings.TrimSpace(line)
+		// Status line sent by the executor at the end of the command
+		if strings.HasPrefix(trimmed, `{"`) {
+			var jsonMetrics map[string]interface{}
+			if err := json.Unmarshal([]byte(trimmed), &jsonMetrics); err != nil {
+				return nil, NewNonFatalError(err)
+			}
+			statusMetrics, err := parseStatus(jsonMetrics)
+			if err != nil { return nil, err }
+			return []*Metrics{statusMetrics}, nil
+		}
+		// Informational messages (e.g. Listing queues for vhost / ...)
+		if !strings.HasPrefix(trimmed, "[") {
+			return nil, NewNonFatalError(fmt.Errorf("not an Erlang term: %s", line))
+		}
+	}
+
+	// The whole line is always scanned to keep the state right, only the last error is returned
+	var metrics []*Metrics
+	var lineErr error
+	for _, char := range line + "\n" {
+		entry, err := p.scan(char)
+		if err != nil { lineErr = err }
+		if entry == "" { continue }
+		queueMetrics, err := p.parseEntry(entry)
+		if err != nil { lineErr = err }
+		if queueMetrics != nil { metrics = append(metrics, queueMetrics) }
+	}
+	return metrics, lineErr
+}
+
+// Keeps the chars of the proplist of the current queue (depth 2) and returns it when it's complete
+func (p *QueueErlangParser) scan(char rune) (string, error) {
+	if p.depth >= 2 {
+		p.entry.WriteRune(char)
+	}
+	if p.quote != 0 {
+		switch {
+		case p.escaped:
+			p.escaped = false
+		case char == '\\':
+			p.escaped = true
+		case char == p.quote:
+			p.quote = 0
+		}
+		return "", nil
+	}
+
+	switch char {
+	case '"', '\'':
+		p.quote = char
+	case '[', '{':
+		p.depth++
+		if p.depth == 2 {
+			if char != '[' {
+				return "", NewNonFatalError(errors.New("unexpected Erlang term, a list of queues is expected"))
+			}
+			p.entry.WriteRune(char)
+		}
+	case ']', '}':
+		p.depth--
+		if p.depth == 1 {
+			entry := p.entry.String()
+			p.entry.Reset()
+			return entry, nil
+		}
+		if p.depth < 0 {
+			p.depth = 0
+			return "", NewNonFatalError(errors.New("unbalanced Erlang term"))
+		}
+	}
+	return "", nil
+}
+
+func (p *QueueErlangParser) parseEntry(entry string) (*Metrics, error) {
+	term, err := ParseErlangTerm(entry)
+	if err != nil { return nil, NewNonFatalError(err) }
+	proplist, _ := term.([]interface{})
+
+	values := make(map[string]interface{})
+	for _, property := range proplist {
+		if tuple, ok := property.(ErlangTuple); ok && len(tuple) == 2 {
+			if key, ok := tuple[0].(ErlangAtom); ok {
+				values[string(key)] = tuple[1]
+			}
+		}
+	}
+
+	queue, okQueue := erlangQueueName(values["name"])
+	if !okQueue {
+		return nil, NewNonFatalError(fmt.Errorf("queue without name: %s", entry))
+	}
+	// If it doesn't go through the filters then we ignore the queue metric
+	if !p.Config.filterQueue(queue) {
+		return nil, nil
+	}
+	state := formatErlangTerm(values["state"])
+
+	queueMetrics := NewMetrics()
+	for name, value := range values {
+		if name == "name" || name == "state" { continue }
+		fValue, ok := value.(float64)
+		if !ok { continue }
+		queueMetrics.AddMetric(name, fValue, map[string]string{"queue": queue, "state": state})
+	}
+	return queueMetrics, nil
+}
+
+// The name is a binary with --formatter erlang and a resource with rabbitmqctl eval:
+// {resource,<<"/">>,queue,<<"q1">>}
+func erlangQueueName(name interface{}) (string, bool) {
+	switch v := name.(type) {
+	case string:
+		return v, true
+	case ErlangTuple:
+		if len(v) == 4 && v[0] == ErlangAtom("resource") {
+			queue, ok := v[3].(string)
+			return queue, ok
+		}
+	}
+	return "", false
+}
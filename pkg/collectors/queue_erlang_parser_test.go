@@ -0,0 +1,95 @@
+package collectors
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func parseAllLines(t *testing.T, parser *QueueErlangParser, lines []string) []*Metrics {
+	var metrics []*Metrics
+	for _, line := range lines {
+		lineMetrics, err := parser.ParseAll(line)
+		if err != nil {
+			var nonFatalError *NonFatalError
+			assert.ErrorAs(t, err, &nonFatalError)
+		}
+		metrics = append(metrics, lineMetrics...)
+	}
+	return metrics
+}
+
+func TestQueueErlangParserOk(t *testing.T) {
+	parser := NewQueueErlangParser(&TrueFilterConfig{})
+	lines := []string{
+		`Timeout: 60.0 seconds ...`,
+		`Listing queues for vhost / ...`,
+		`[[{name,<<"delegate_encryption_test.dev">>},`,
+		`  {state,running},`,
+		`  {messages_ready,1},`,
+		`  {message_bytes_ready,288},`,
+		`  {memory,34788},`,
+		`  {consumers,6},`,
+		`  {consumer_utilisation,''},`,
+		`  {head_message_timestamp,1630920836}],`,
+		` [{name,<<"with\ttab [and] {brackets}">>},{state,{syncing,5}},{messages_ready,0}],[{name,<<"caf\303\251">>},{state,running},{messages_ready,3}]]`,
+		`{"command_executed":"rabbitmqctl list_queues --formatter erlang name","command_runtime":0.5655179}`,
+	}
+	metrics := parseAllLines(t, parser, lines)
+
+	assert.Equal(t, 4, len(metrics))
+	expectedLabels := map[string]string{"queue": "delegate_encryption_test.dev", "state": "running"}
+	checkValue(t, metrics[0], "message_bytes_ready", 288)
+	checkValue(t, metrics[0], "head_message_timestamp", 1630920836)
+	checkLabels(t, metrics[0], "memory", expectedLabels)
+	_, err := metrics[0].GetMetricValue("consumer_utilisation")
+	assert.NotNil(t, err)
+
+	checkLabels(t, metrics[1], "messages_ready", map[string]string{"queue": "with\ttab [and] {brackets}", "state": "{syncing,5}"})
+	checkValue(t, metrics[2], "messages_ready", 3)
+	checkLabels(t, metrics[2], "messages_ready", map[string]string{"queue": "café", "state": "running"})
+	checkValue(t, metrics[3], "command_runtime", 0.5655179)
+}
+
+func TestQueueErlangParserParse(t *testing.T) {
+	parser := NewQueueErlangParser(&TrueFilterConfig{})
+	metrics, err := parser.Parse(`[[{name,<<"q1">>},{state,running},{messages_ready,1}],`)
+	assert.Nil(t, err)
+	checkValue(t, metrics, "messages_ready", 1)
+
+	// The queues of a line are not dropped
+	metrics, err = parser.Parse(` [{name,<<"q2">>},{messages_ready,2}],[{name,<<"q3">>},{messages_ready,3}]]`)
+	assert.Nil(t, metrics)
+	assert.EqualError(t, err, "the line completes 2 queues, only one can be returned by Parse")
+}
+
+func TestQueueErlangEvalParserOk(t *testing.T) {
+	parser := NewQueueErlangEvalParser(&TrueFilterConfig{})
+	assert.Equal(t, "eval", parser.GetArguments()[0])
+	assert.Equal(t, `rabbit_amqqueue:info_all(<<"/">>, [name,state,messages_ready,message_bytes_ready,messages_unacknowledged,` +
+		`message_bytes_unacknowledged,memory,consumers,consumer_utilisation,head_message_timestamp]).`, parser.GetArguments()[1])
+	assert.Equal(t, "eval", parser.GetVhostArguments("test")[0])
+	assert.Contains(t, parser.GetVhostArguments("test")[1], `info_all(<<"test">>`)
+
+	lines := []string{
+		`[[{name,{resource,<<"/">>,queue,<<"SemanticsSystemTestQueue">>}},`,
+		`  {state,running},`,
+		`  {messages_ready,0},`,
+		`  {memory,34668},`,
+		`  {consumers,0}]]`,
+	}
+	metrics := parseAllLines(t, parser.Copy().(*QueueErlangParser), lines)
+
+	assert.Equal(t, 1, len(metrics))
+	checkValue(t, metrics[0], "memory", 34668)
+	checkLabels(t, metrics[0], "memory", map[string]string{"queue": "SemanticsSystemTestQueue", "state": "running"})
+}
+
+func TestQueueErlangParserFiltered(t *testing.T) {
+	parser := NewQueueErlangParser(&FalseFilterConfig{})
+	metrics := parseAllLines(t, parser, []string{`[[{name,<<"q1">>},{state,running},{messages_ready,0}]]`})
+	assert.Equal(t, 0, len(metrics))
+
+	parser = NewQueueErlangParser(&TrueFilterConfig{})
+	metrics = parseAllLines(t, parser, []string{`[[{state,running}],[{name,<<"q2">>},{state,running},{consumers,1}]]`})
+	assert.Equal(t, 1, len(metrics))
+}
@@ -8,6 +8,8 @@ import (
 
 type IConfig interface {
 	filterQueue(string) bool
+	// Config that doesn't change with the reloads, used for a whole collection
+	snapshot() IConfig
 }
 
 type QueueJSONParser struct {
@@ -38,6 +40,20 @@ func NewQueueJSONParser(config IConfig) *QueueJSONParser {
 	}
 }
 
+func (p *QueueJSONParser) GetName() string {
+	return "queues"
+}
+
+func (p *QueueJSONParser) GetConfig() IConfig {
+	return p.Config
+}
+
+func (p *QueueJSONParser) WithConfig(config IConfig) ICmdParser {
+	parser := *p
+	parser.Config = config
+	return &parser
+}
+
 func (p *QueueJSONParser) GetCmd() string {
 	return p.Cmd
 }
@@ -70,11 +86,16 @@ func (p *QueueJSONParser) parseQueue(jsonMetrics map[string]interface{}) (*Metri
 	if !p.Config.filterQueue(queue) {
 		return nil, nil
 	}
+	labels := map[string]string{"queue": queue, "state": state}
+	// Only the management API returns the vhost, the commands run on a single one
+	if vhost, ok := jsonMetrics["vhost"].(string); ok {
+		labels["vhost"] = vhost
+	}
 	for name, value := range jsonMetrics {
-		if name == "name" || name == "state" { continue }
+		if name == "name" || name == "state" || name == "vhost" { continue }
 		fValue, ok := value.(float64)
 		if !ok { continue }
-		queueMetrics.AddMetric(name, fValue, map[string]string{"queue": queue, "state": state})
+		queueMetrics.AddMetric(name, fValue, labels)
 	}
 
 	return queueMetrics, nil
@@ -9,11 +9,17 @@ type TrueFilterConfig struct{}
 func (c *TrueFilterConfig) filterQueue(name string) bool {
 	return true
 }
+func (c *TrueFilterConfig) snapshot() IConfig {
+	return c
+}
 
 type FalseFilterConfig struct{}
 func (c *FalseFilterConfig) filterQueue(name string) bool {
 	return false
 }
+func (c *FalseFilterConfig) snapshot() IConfig {
+	return c
+}
 
 func TestQueueJsonParserOk(t *testing.T) {
 	var parser ICmdParser
@@ -46,6 +46,20 @@ func NewQueueParser(config IConfig) *QueueParser {
 	}
 }
 
+func (p *QueueParser) GetName() string {
+	return "queues"
+}
+
+func (p *QueueParser) GetConfig() IConfig {
+	return p.Config
+}
+
+func (p *QueueParser) WithConfig(config IConfig) ICmdParser {
+	parser := *p
+	parser.Config = config
+	return &parser
+}
+
 func (p *QueueParser) GetCmd() string {
 	return p.Cmd
 }
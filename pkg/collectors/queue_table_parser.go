@@ -0,0 +1,207 @@
+package collectors
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Parses the tabular output of rabbitmqctl list_queues. The columns are mapped by the names of the header line
+// (name state messages_ready ...), when there is no header (-q or --no-table-headers) the order of the info
+// items of the command is used. The lines that can't be parsed are logged with the reason.
+type QueueTableParser struct {
+	Cmd			string
+	Config		IConfig
+	Arguments	[]string
+	columns		[]string
+	lineNumber	int
+}
+
+func NewQueueTableParser(config IConfig) *QueueTableParser {
+	return &QueueTableParser{
+		Cmd: "rabbitmqctl",
+		Config: config,
+		Arguments: append([]string{"list_queues"}, queueInfoItems...),
+	}
+}
+
+func (p *QueueTableParser) GetName() string {
+	return "queues"
+}
+
+func (p *QueueTableParser) GetCmd() string {
+	return p.Cmd
+}
+
+func (p *QueueTableParser) GetArguments() []string {
+	return p.Arguments
+}
+
+// Every collection needs its own parser since the header changes the columns
+func (p *QueueTableParser) GetConfig() IConfig {
+	return p.Config
+}
+
+func (p *QueueTableParser) WithConfig(config IConfig) ICmdParser {
+	parser := p.Copy().(*QueueTableParser)
+	parser.Config = config
+	return parser
+}
+
+func (p *QueueTableParser) Copy() IMultiCmdParser {
+	return &QueueTableParser{
+		Cmd: p.Cmd,
+		Config: p.Config,
+		Arguments: p.Arguments,
+	}
+}
+
+func (p *QueueTableParser) ParseAll(line string) ([]*Metrics, error) {
+	metrics, err := p.Parse(line)
+	if metrics == nil {
+		return nil, err
+	}
+	return []*Metrics{metrics}, err
+}
+
+func (p *QueueTableParser) Parse(line string) (*Metrics, error) {
+	p.lineNumber++
+	line = strings.TrimRight(line, "\r\n")
+
+	// Status line sent by the executor at the end of the command
+	if strings.HasPrefix(line, `{"`) {
+		var jsonMetrics map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &jsonMetrics); err != nil {
+			return nil, NewNonFatalError(err)
+		}
+		return parseStatus(jsonMetrics)
+	}
+
+	fields := strings.Split(line, "\t")
+	if p.isHeader(fields) {
+		p.columns = fields
+		return nil, nil
+	}
+	// Informational messages (e.g. Listing queues for vhost / ...)
+	if len(fields) < 2 {
+		return nil, NewNonFatalError(fmt.Errorf("line %d is not a queue: %s", p.lineNumber, line))
+	}
+
+	queueMetrics, err := p.parseQueue(fields)
+	if err != nil {
+		err = fmt.Errorf("line %d failed: %v: %q", p.lineNumber, err, line)
+		log.Warn(err)
+		return nil, NewNonFatalError(err)
+	}
+	return queueMetrics, nil
+}
+
+// The header has the names of the info items requested, name included
+func (p *QueueTableParser) isHeader(fields []string) bool {
+	if len(fields) < 2 {
+		return false
+	}
+	hasName := false
+	for _, field := range fields {
+		if !p.hasInfoItem(field) {
+			return false
+		}
+		hasName = hasName || field == "name"
+	}
+	return hasName
+}
+
+func (p *QueueTableParser) hasInfoItem(name string) bool {
+	for _, argument := range p.Arguments[1:] {
+		if argument == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *QueueTableParser) getColumns() []string {
+	if p.columns != nil {
+		return p.columns
+	}
+	var columns []string
+	for _, argument := range p.Arguments[1:] {
+		if !strings.HasPrefix(argument, "-") {
+			columns = append(columns, argument)
+		}
+	}
+	return columns
+}
+
+// Empty columns at the end of the line can be missing
+func (p *QueueTableParser) parseQueue(fields []string) (*Metrics, error) {
+	columns := p.getColumns()
+	if len(fields) > len(columns) {
+		return nil, fmt.Errorf("expected %d columns, found %d", len(columns), len(fields))
+	}
+
+	values := make(map[string]string)
+	for i, field := range fields {
+		values[columns[i]] = field
+	}
+	queue, err := unescapeTabular(values["name"])
+	if err != nil { return nil, fmt.Errorf("invalid name: %v", err) }
+	if queue == "" { return nil, fmt.Errorf("empty name") }
+	state := values["state"]
+
+	// If it doesn't go through the filters then we ignore the queue metric
+	if !p.Config.filterQueue(queue) {
+		return nil, nil
+	}
+	queueMetrics := NewMetrics()
+	for name, value := range values {
+		if name == "name" || name == "state" || value == "" { continue }
+		fValue, err := strconv.ParseFloat(value, 64)
+		if err != nil { return nil, fmt.Errorf("invalid value for %s: %s", name, value) }
+		queueMetrics.AddMetric(name, fValue, map[string]string{"queue": queue, "state": state})
+	}
+	return queueMetrics, nil
+}
+
+// rabbitmqctl escapes the names as in C: tabs, new lines, backslashes and non-ASCII characters (octal bytes)
+func unescapeTabular(text string) (string, error) {
+	if !strings.Contains(text, `\`) {
+		return text, nil
+	}
+	var bytes []byte
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\\' {
+			bytes = append(bytes, text[i])
+			continue
+		}
+		i++
+		if i >= len(text) {
+			return "", fmt.Errorf("incomplete escape sequence")
+		}
+		switch c := text[i]; {
+		case c >= '0' && c <= '7':
+			end := i
+			for end < len(text) && end - i < 3 && text[end] >= '0' && text[end] <= '7' {
+				end++
+			}
+			value, err := strconv.ParseUint(text[i:end], 8, 8)
+			if err != nil { return "", fmt.Errorf("invalid escape sequence \\%s", text[i:end]) }
+			bytes = append(bytes, byte(value))
+			i = end - 1
+		case c == 'x' && i + 2 < len(text):
+			value, err := strconv.ParseUint(text[i + 1:i + 3], 16, 8)
+			if err != nil { return "", fmt.Errorf("invalid escape sequence \\%s", text[i:i + 3]) }
+			bytes = append(bytes, byte(value))
+			i += 2
+		default:
+			bytes = append(bytes, byte(unescapeChar(c)))
+		}
+	}
+	if !utf8.Valid(bytes) {
+		return "", fmt.Errorf("invalid UTF-8 sequence")
+	}
+	return string(bytes), nil
+}
@@ -0,0 +1,95 @@
+package collectors
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestQueueTableParserHeader(t *testing.T) {
+	parser := NewQueueTableParser(&TrueFilterConfig{})
+	lines := []string{
+		"Timeout: 60.0 seconds ...",
+		"Listing queues for vhost / ...",
+		"state	name	messages_ready	memory	consumers	consumer_utilisation",
+		"{syncing, 5}	with\\ttab\\303\\251	1	34764	2	0.5",
+	}
+	assert.Nil(t, parseTableLines(t, parser, lines[:2]))
+	metrics, err := parser.Parse(lines[2])
+	assert.Nil(t, err)
+	assert.Nil(t, metrics)
+	metrics, err = parser.Parse(lines[3])
+	assert.Nil(t, err)
+
+	expectedLabels := map[string]string{"queue": "with\ttabé", "state": "{syncing, 5}"}
+	checkValue(t, metrics, "messages_ready", 1)
+	checkLabels(t, metrics, "messages_ready", expectedLabels)
+	checkValue(t, metrics, "memory", 34764)
+	checkValue(t, metrics, "consumers", 2)
+	checkValue(t, metrics, "consumer_utilisation", 0.5)
+	_, err = metrics.GetMetricValue("message_bytes_ready")
+	assert.NotNil(t, err)
+}
+
+func TestQueueTableParserWithoutHeader(t *testing.T) {
+	parser := NewQueueTableParser(&TrueFilterConfig{})
+	metrics, err := parser.Parse("q33	running	1	2	3	4	34664	5	0.1	")
+	assert.Nil(t, err)
+	checkValue(t, metrics, "message_bytes_unacknowledged", 4)
+	checkValue(t, metrics, "consumer_utilisation", 0.1)
+	checkLabels(t, metrics, "memory", map[string]string{"queue": "q33", "state": "running"})
+
+	metrics, err = parser.Parse("SemanticsSystemTestQueue	running	0	0	0	0	34668	0")
+	assert.Nil(t, err)
+	checkValue(t, metrics, "memory", 34668)
+}
+
+func TestQueueTableParserFailedLines(t *testing.T) {
+	parser := NewQueueTableParser(&TrueFilterConfig{})
+	_, err := parser.Parse("name	state	messages_ready")
+	assert.Nil(t, err)
+
+	metrics, err := parser.Parse("q1	running	not-a-number")
+	assert.Nil(t, metrics)
+	assert.IsType(t, &NonFatalError{}, err)
+	assert.Equal(t, `line 2 failed: invalid value for messages_ready: not-a-number: "q1\trunning\tnot-a-number"`, err.Error())
+
+	_, err = parser.Parse("q1	with	tab	running	1")
+	assert.Contains(t, err.Error(), "line 3 failed: expected 3 columns, found 5")
+
+	_, err = parser.Parse("q1\\	running	1")
+	assert.Contains(t, err.Error(), "line 4 failed: invalid name")
+}
+
+func TestQueueTableParserStatus(t *testing.T) {
+	parser := NewQueueTableParser(&FalseFilterConfig{})
+	metrics, err := parser.Parse("q1	running	1")
+	assert.Nil(t, err)
+	assert.Nil(t, metrics)
+
+	metrics, err = parser.Parse(`{"command_executed":"rabbitmqctl list_queues name","command_runtime":0.5}`)
+	assert.Nil(t, err)
+	checkValue(t, metrics, "command_runtime", 0.5)
+}
+
+func TestCollectTableOk(t *testing.T) {
+	console := NewCmdCollector(NewQueueTableParser(&TrueFilterConfig{}), NewTestExecutorFactory(), 1000000, 1000000)
+	results, err := console.Collect()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(results))
+	value, err := results[0].GetMetricValue("head_message_timestamp")
+	assert.Nil(t, err)
+	assert.Equal(t, float64(1630920836), value)
+}
+
+func parseTableLines(t *testing.T, parser *QueueTableParser, lines []string) []*Metrics {
+	var metrics []*Metrics
+	for _, line := range lines {
+		lineMetrics, err := parser.ParseAll(line)
+		if err != nil {
+			assert.IsType(t, &NonFatalError{}, err)
+		}
+		metrics = append(metrics, lineMetrics...)
+	}
+	return metrics
+}
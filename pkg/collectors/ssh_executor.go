@@ -0,0 +1,216 @@
+package collectors
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sshDefaultPort		= "22"
+	sshDialTimeout		= 30 * time.Second
+	// Lines of list_queues can be longer than the default buffer of the scanner
+	sshMaxLineSize		= 1024 * 1024
+)
+
+// Runs the commands on a remote host over SSH. The connection is reused by all the executions.
+type SSHExecutorFactory struct {
+	address		string
+	config		*ssh.ClientConfig
+	client		*ssh.Client
+	mutex		sync.Mutex
+}
+
+// Only key based authentication is supported and the host key must be in the known_hosts file.
+// The key and the known_hosts file default to the ones in ~/.ssh
+func NewSSHExecutorFactory(host string, user string, keyFile string, knownHostsFile string) (*SSHExecutorFactory, error) {
+	if host == "" {
+		return nil, fmt.Errorf("the host is required by the ssh executor")
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, sshDefaultPort)
+	}
+	if user == "" {
+		user = currentUser()
+	}
+	if keyFile == "" {
+		keyFile = filepath.Join(homeDir(), ".ssh", "id_rsa")
+	}
+	if knownHostsFile == "" {
+		knownHostsFile = filepath.Join(homeDir(), ".ssh", "known_hosts")
+	}
+
+	key, err := ioutil.ReadFile(keyFile)
+	if err != nil { return nil, err }
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil { return nil, fmt.Errorf("invalid ssh key %s: %v", keyFile, err) }
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil { return nil, err }
+
+	return &SSHExecutorFactory{
+		address: host,
+		config: &ssh.ClientConfig{
+			User: user,
+			Auth: []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+			Timeout: sshDialTimeout,
+		},
+	}, nil
+}
+
+func (f *SSHExecutorFactory) NewExecutor(command string, arguments []string, outputBuffer int) IExecutor {
+	return &SSHExecutor{
+		factory: f,
+		command: command,
+		arguments: arguments,
+		outputCh: make(chan string, outputBuffer),
+	}
+}
+
+// The connection is opened again when the previous one is broken (e.g. the remote host was restarted)
+func (f *SSHExecutorFactory) newSession() (*ssh.Session, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.client != nil {
+		session, err := f.client.NewSession()
+		if err == nil {
+			return session, nil
+		}
+		log.Warningf("SSH connection to %s is broken, reconnecting: %v", f.address, err)
+		f.client.Close()
+		f.client = nil
+	}
+
+	client, err := ssh.Dial("tcp", f.address, f.config)
+	if err != nil { return nil, fmt.Errorf("ssh connection to %s failed: %v", f.address, err) }
+	log.Infof("SSH connection to %s opened", f.address)
+	f.client = client
+	return f.client.NewSession()
+}
+
+func (f *SSHExecutorFactory) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.client == nil {
+		return nil
+	}
+	err := f.client.Close()
+	f.client = nil
+	return err
+}
+
+type SSHExecutor struct {
+	factory		*SSHExecutorFactory
+	command		string
+	arguments	[]string
+	outputCh	chan string
+}
+
+// The Output Channel is closed when the execution finishes.
+func (e *SSHExecutor) Output() <-chan string {
+	return e.outputCh
+}
+
+func (e *SSHExecutor) Execute(ctx context.Context) error {
+	defer close(e.outputCh)
+
+	session, err := e.factory.newSession()
+	if err != nil { return err }
+	defer session.Close()
+	stdout, err := session.StdoutPipe()
+	if err != nil { return err }
+	stderr, err := session.StderrPipe()
+	if err != nil { return err }
+
+	remoteCommand := shellQuote(append([]string{e.command}, e.arguments...))
+	log.Infof("Executing on %s: %v %v", e.factory.address, e.command, strings.Join(maskSecrets(e.arguments), " "))
+	start := time.Now()
+	if err := session.Start(remoteCommand); err != nil { return err }
+
+	// Errors on StdErr don't cancel the execution
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			log.Errorf("Command returned an error: %v", scanner.Text())
+		}
+	}()
+
+	doneCh := make(chan error, 1)
+	go func() {
+		if err := e.streamOutput(ctx, stdout); err != nil {
+			doneCh <- err
+			return
+		}
+		doneCh <- session.Wait()
+	}()
+
+	select {
+	case err := <-doneCh:
+		if err != nil {
+			log.Errorf("Command failed on %s: %v", e.factory.address, err)
+			return err
+		}
+		if status, err := commandStatusToJSON(e.command, e.arguments, time.Since(start).Seconds()); err == nil {
+			e.outputCh <- status
+		}
+		log.Infof("Command end streaming successfully on %s", e.factory.address)
+		return nil
+	// Context pass to the execution is cancel for any reason (timeout or external errors)
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGTERM)
+		session.Close()
+		<-doneCh
+		return fmt.Errorf("executor timeout or parser error while running [%v %v]", e.command, maskSecrets(e.arguments))
+	}
+}
+
+func (e *SSHExecutor) streamOutput(ctx context.Context, stdout io.Reader) error {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64 * 1024), sshMaxLineSize)
+	for scanner.Scan() {
+		select {
+		case e.outputCh <- scanner.Text():
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return scanner.Err()
+}
+
+// The remote command is run by the shell of the user, so every argument is single quoted
+func shellQuote(arguments []string) string {
+	quoted := make([]string, len(arguments))
+	for i, argument := range arguments {
+		quoted[i] = "'" + strings.ReplaceAll(argument, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Same default as ssh, the user running the agent
+func currentUser() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
+func homeDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "."
+	}
+	return home
+}
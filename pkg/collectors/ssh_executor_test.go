@@ -0,0 +1,175 @@
+package collectors
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// In-process SSH server that answers every command with a JSON list_queues output
+type TestSSHServer struct {
+	listener	net.Listener
+	connections	int32
+	commands	chan string
+}
+
+func NewTestSSHServer(t *testing.T, hostKey ssh.Signer, clientKey ssh.PublicKey) *TestSSHServer {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == "rabbitmq" && string(key.Marshal()) == string(clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := &TestSSHServer{listener: listener, commands: make(chan string, 10)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil { return }
+			go server.serve(conn, config)
+		}
+	}()
+	return server
+}
+
+func (s *TestSSHServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil { return }
+	atomic.AddInt32(&s.connections, 1)
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil { continue }
+		go func() {
+			defer channel.Close()
+			for request := range channelRequests {
+				if request.Type != "exec" {
+					request.Reply(false, nil)
+					continue
+				}
+				request.Reply(true, nil)
+				s.commands <- string(request.Payload[4:])
+				fmt.Fprintln(channel, `{"name":"q1.dev","state":"running","messages_ready":3,"memory":55692}`)
+				fmt.Fprintln(channel, `{"name":"q2.dev","state":"running","messages_ready":5,"memory":55692}`)
+				status := make([]byte, 4)
+				binary.BigEndian.PutUint32(status, 0)
+				channel.SendRequest("exit-status", false, status)
+				return
+			}
+		}()
+	}
+}
+
+func writeClientKey(t *testing.T) (string, ssh.PublicKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	pemKey, err := marshalED25519PrivateKey(privateKey)
+	assert.Nil(t, err)
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	assert.Nil(t, os.WriteFile(keyFile, pemKey, 0600))
+
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	assert.Nil(t, err)
+	return keyFile, sshPublicKey
+}
+
+func writeKnownHosts(t *testing.T, address string, hostKey ssh.PublicKey) string {
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(address)}, hostKey)
+	assert.Nil(t, os.WriteFile(knownHostsFile, []byte(line + "\n"), 0600))
+	return knownHostsFile
+}
+
+// x/crypto can't marshal OpenSSH private keys, PKCS#8 is also accepted by ssh.ParsePrivateKey
+func marshalED25519PrivateKey(key ed25519.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil { return nil, err }
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func newTestHostKey(t *testing.T) ssh.Signer {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	assert.Nil(t, err)
+	return signer
+}
+
+func TestSSHCollect(t *testing.T) {
+	hostKey := newTestHostKey(t)
+	keyFile, clientKey := writeClientKey(t)
+	server := NewTestSSHServer(t, hostKey, clientKey)
+	defer server.listener.Close()
+	address := server.listener.Addr().String()
+	knownHostsFile := writeKnownHosts(t, address, hostKey.PublicKey())
+
+	factory, err := NewSSHExecutorFactory(address, "rabbitmq", keyFile, knownHostsFile)
+	assert.Nil(t, err)
+	defer factory.Close()
+
+	console := NewCmdCollector(NewQueueJSONParser(&TrueFilterConfig{}), factory, 1000000, 1000000)
+	console.CtlOptions = CtlOptions{Node: "rabbit@node1"}
+	for i := 0; i < 2; i++ {
+		results, err := console.Collect()
+		assert.Nil(t, err)
+		assert.Equal(t, 3, len(results))
+		value, err := results[1].GetMetricValue("messages_ready")
+		assert.Nil(t, err)
+		assert.Equal(t, float64(5), value)
+		_, err = results[2].GetMetricValue("command_runtime")
+		assert.Nil(t, err)
+		assert.Equal(t, `'rabbitmqctl' '-n' 'rabbit@node1' 'list_queues' '--formatter' 'json' 'name' 'state' 'messages_ready' ` +
+			`'message_bytes_ready' 'messages_unacknowledged' 'message_bytes_unacknowledged' 'memory' 'consumers' ` +
+			`'consumer_utilisation' 'head_message_timestamp'`, <-server.commands)
+	}
+
+	// The connection is reused by all the collections
+	assert.Equal(t, int32(1), atomic.LoadInt32(&server.connections))
+}
+
+func TestSSHUnknownHost(t *testing.T) {
+	hostKey := newTestHostKey(t)
+	keyFile, clientKey := writeClientKey(t)
+	server := NewTestSSHServer(t, hostKey, clientKey)
+	defer server.listener.Close()
+	knownHostsFile := writeKnownHosts(t, server.listener.Addr().String(), newTestHostKey(t).PublicKey())
+
+	factory, err := NewSSHExecutorFactory(server.listener.Addr().String(), "rabbitmq", keyFile, knownHostsFile)
+	assert.Nil(t, err)
+	console := NewCmdCollector(NewQueueJSONParser(&TrueFilterConfig{}), factory, 1000000, 1000000)
+	_, err = console.Collect()
+	assert.NotNil(t, err)
+}
+
+func TestSSHDefaultUser(t *testing.T) {
+	keyFile, _ := writeClientKey(t)
+	knownHostsFile := writeKnownHosts(t, "127.0.0.1:22", newTestHostKey(t).PublicKey())
+
+	factory, err := NewSSHExecutorFactory("127.0.0.1", "", keyFile, knownHostsFile)
+	assert.Nil(t, err)
+	current, err := user.Current()
+	assert.Nil(t, err)
+	assert.Equal(t, current.Username, factory.config.User)
+	assert.Equal(t, "127.0.0.1:22", factory.address)
+}
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, `'rabbitmqctl' 'list_queues' '-p' 'it'\''s'`, shellQuote([]string{"rabbitmqctl", "list_queues", "-p", "it's"}))
+}
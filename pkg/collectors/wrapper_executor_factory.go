@@ -0,0 +1,114 @@
+package collectors
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+const (
+	ExecutorLocal	= "local"
+	ExecutorDocker	= "docker"
+	ExecutorKubectl	= "kubectl"
+	ExecutorSSH		= "ssh"
+)
+
+// Options to select how the commands are executed, set in the executor table of the config file
+type ExecutorOptions struct {
+	Type		string
+	Path		string
+	Container	string
+	Pod			string
+	Namespace	string
+	Arguments	[]string
+	Host		string
+	User		string
+	KeyFile		string
+	KnownHosts	string
+}
+
+func (o ExecutorOptions) IsLocal() bool {
+	return o.Type == "" || o.Type == ExecutorLocal
+}
+
+// Only useful when the wrapper runs locally
+func (o ExecutorOptions) CheckCmd() error {
+	if o.IsLocal() || o.Type == ExecutorSSH {
+		return nil
+	}
+	path := o.Path
+	if path == "" {
+		path = o.Type
+	}
+	if _, err := exec.LookPath(path); err != nil {
+		return fmt.Errorf("%s not found: %v", path, err)
+	}
+	return nil
+}
+
+func NewExecutorFactoryFromOptions(options ExecutorOptions) (IExecutorFactory, error) {
+	switch options.Type {
+	case "", ExecutorLocal:
+		return NewExecutorFactory(), nil
+	case ExecutorDocker:
+		if options.Container == "" {
+			return nil, fmt.Errorf("the container is required by the %s executor", options.Type)
+		}
+		return NewDockerExecutorFactory(options.Path, options.Container, options.Arguments), nil
+	case ExecutorKubectl:
+		if options.Pod == "" {
+			return nil, fmt.Errorf("the pod is required by the %s executor", options.Type)
+		}
+		return NewKubectlExecutorFactory(options.Path, options.Namespace, options.Pod, options.Container, options.Arguments), nil
+	case ExecutorSSH:
+		return NewSSHExecutorFactory(options.Host, options.User, options.KeyFile, options.KnownHosts)
+	}
+	return nil, fmt.Errorf("unknown executor %q", options.Type)
+}
+
+// Runs the commands through another one (e.g. docker exec <container> rabbitmqctl ...), the output is streamed
+// by the same Executor so the parsers don't change
+type WrapperExecutorFactory struct {
+	Wrapper				string
+	WrapperArguments	[]string
+}
+
+// docker exec [arguments] <container> <command>
+func NewDockerExecutorFactory(docker string, container string, arguments []string) *WrapperExecutorFactory {
+	if docker == "" {
+		docker = "docker"
+	}
+	wrapperArguments := append([]string{"exec"}, arguments...)
+	return &WrapperExecutorFactory{
+		Wrapper: docker,
+		WrapperArguments: append(wrapperArguments, container),
+	}
+}
+
+// kubectl exec [arguments] [-n namespace] <pod> [-c container] -- <command>
+func NewKubectlExecutorFactory(kubectl string, namespace string, pod string, container string, arguments []string) *WrapperExecutorFactory {
+	if kubectl == "" {
+		kubectl = "kubectl"
+	}
+	wrapperArguments := append([]string{"exec"}, arguments...)
+	if namespace != "" {
+		wrapperArguments = append(wrapperArguments, "-n", namespace)
+	}
+	wrapperArguments = append(wrapperArguments, pod)
+	if container != "" {
+		wrapperArguments = append(wrapperArguments, "-c", container)
+	}
+	return &WrapperExecutorFactory{
+		Wrapper: kubectl,
+		WrapperArguments: append(wrapperArguments, "--"),
+	}
+}
+
+func (f *WrapperExecutorFactory) NewExecutor(command string, arguments []string, outputBuffer int) IExecutor {
+	wrappedArguments := append(append([]string{}, f.WrapperArguments...), command)
+	return &Executor{
+		command: f.Wrapper,
+		arguments: append(wrappedArguments, arguments...),
+		outputCh: make(chan string, outputBuffer),
+		endExecutionCh: make(chan struct{}, 1),
+	}
+}
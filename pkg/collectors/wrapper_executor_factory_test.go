@@ -0,0 +1,76 @@
+package collectors
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Fake docker/kubectl: prints the arguments it receives and, after them, the output of a JSON list_queues
+const fakeWrapper = `#!/bin/sh
+printf '%s\n' "$@"
+echo '{"name":"q1.dev","state":"running","messages_ready":3,"memory":55692}'
+`
+
+func writeFakeWrapper(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "fake-wrapper")
+	assert.Nil(t, os.WriteFile(path, []byte(fakeWrapper), 0755))
+	return path
+}
+
+func runExecutor(t *testing.T, executor IExecutor) []string {
+	var lines []string
+	done := make(chan struct{})
+	go func() {
+		for line := range executor.Output() {
+			lines = append(lines, line)
+		}
+		close(done)
+	}()
+	assert.Nil(t, executor.Execute(context.Background()))
+	<-done
+	return lines
+}
+
+func TestDockerExecutor(t *testing.T) {
+	factory := NewDockerExecutorFactory(writeFakeWrapper(t), "rabbitmq", []string{"-u", "rabbitmq"})
+	lines := runExecutor(t, factory.NewExecutor("rabbitmqctl", []string{"-q", "list_queues"}, 100))
+
+	assert.Equal(t, []string{"exec", "-u", "rabbitmq", "rabbitmq", "rabbitmqctl", "-q", "list_queues"}, lines[:7])
+}
+
+func TestKubectlExecutor(t *testing.T) {
+	factory := NewKubectlExecutorFactory(writeFakeWrapper(t), "messaging", "rabbitmq-0", "rabbitmq", nil)
+	lines := runExecutor(t, factory.NewExecutor("rabbitmqctl", []string{"list_queues"}, 100))
+
+	expected := []string{"exec", "-n", "messaging", "rabbitmq-0", "-c", "rabbitmq", "--", "rabbitmqctl", "list_queues"}
+	assert.Equal(t, expected, lines[:9])
+}
+
+func TestCollectWithWrapperExecutor(t *testing.T) {
+	factory, err := NewExecutorFactoryFromOptions(ExecutorOptions{Type: ExecutorKubectl, Path: writeFakeWrapper(t), Pod: "rabbitmq-0"})
+	assert.Nil(t, err)
+	console := NewCmdCollector(NewQueueJSONParser(&TrueFilterConfig{}), factory, 1000000, 1000000)
+	results, err := console.Collect()
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	value, err := results[0].GetMetricValue("messages_ready")
+	assert.Nil(t, err)
+	assert.Equal(t, float64(3), value)
+	_, err = results[1].GetMetricValue("command_runtime")
+	assert.Nil(t, err)
+}
+
+func TestExecutorFactoryFromOptions(t *testing.T) {
+	_, err := NewExecutorFactoryFromOptions(ExecutorOptions{})
+	assert.Nil(t, err)
+	_, err = NewExecutorFactoryFromOptions(ExecutorOptions{Type: ExecutorDocker})
+	assert.NotNil(t, err)
+	_, err = NewExecutorFactoryFromOptions(ExecutorOptions{Type: ExecutorKubectl})
+	assert.NotNil(t, err)
+	_, err = NewExecutorFactoryFromOptions(ExecutorOptions{Type: "telnet"})
+	assert.NotNil(t, err)
+}
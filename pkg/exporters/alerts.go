@@ -0,0 +1,296 @@
+package exporters
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AlertFiring		= "firing"
+	AlertResolved	= "resolved"
+
+	alertQueueSize	= 100
+)
+
+// Rule evaluated on every queue of the snapshot, e.g. consumers == 0 and messages_ready > 0. It fires when the
+// condition is true for the duration of For.
+type AlertRule struct {
+	Name		string
+	QueueRegex	string
+	Condition	string
+	For			time.Duration
+}
+
+// Options of the alerts set in the alerting table of the config file, the notifications are only logged and
+// exported as metrics when the webhook is not set
+type AlertOptions struct {
+	WebhookURL	string
+	Headers		map[string]string
+	Rules		[]AlertRule
+	Retries		int
+	RetryDelay	time.Duration
+	Timeout		time.Duration
+}
+
+type AlertNotification struct {
+	Status		string				`json:"status"`
+	Alert		string				`json:"alert"`
+	Condition	string				`json:"condition"`
+	Queue		string				`json:"queue"`
+	Vhost		string				`json:"vhost"`
+	Metrics		map[string]float64	`json:"metrics"`
+	StartsAt	time.Time			`json:"starts_at"`
+	EndsAt		*time.Time			`json:"ends_at,omitempty"`
+}
+
+type AlertWebhookPayload struct {
+	Alerts	[]AlertNotification	`json:"alerts"`
+}
+
+// <metric> <operator> <number>
+type alertClause struct {
+	metric		string
+	operator	string
+	threshold	float64
+}
+
+type alertRule struct {
+	AlertRule
+	queueRegex	*regexp.Regexp
+	clauses		[]alertClause
+}
+
+type alertKey struct {
+	rule	int
+	vhost	string
+	queue	string
+}
+
+// Pending until the condition has been true for the duration of the rule
+type alertState struct {
+	since	time.Time
+	firing	bool
+	queue	QueueSnapshot
+}
+
+// Evaluates the rules after every collection and sends the firing and resolved alerts to the webhook, in order,
+// without blocking the collections
+type AlertEvaluator struct {
+	Options			AlertOptions
+	HTTPClient		*http.Client
+	rules			[]alertRule
+	mutex			sync.Mutex
+	states			map[alertKey]*alertState
+	notifications	chan []AlertNotification
+	startSender		sync.Once
+}
+
+var alertClauseRegex = regexp.MustCompile(`^([a-z_]+)\s*(>=|<=|==|!=|>|<)\s*(\S+)$`)
+
+func NewAlertEvaluator(options AlertOptions) (*AlertEvaluator, error) {
+	evaluator := &AlertEvaluator{
+		Options: options,
+		HTTPClient: &http.Client{Timeout: options.Timeout},
+		states: make(map[alertKey]*alertState),
+		notifications: make(chan []AlertNotification, alertQueueSize),
+	}
+	for _, rule := range options.Rules {
+		compiled, err := compileAlertRule(rule)
+		if err != nil { return nil, err }
+		evaluator.rules = append(evaluator.rules, compiled)
+	}
+	return evaluator, nil
+}
+
+func compileAlertRule(rule AlertRule) (alertRule, error) {
+	compiled := alertRule{AlertRule: rule}
+	if compiled.Name == "" {
+		compiled.Name = rule.Condition
+	}
+	if rule.QueueRegex != "" {
+		queueRegex, err := regexp.Compile(rule.QueueRegex)
+		if err != nil { return compiled, fmt.Errorf("invalid queue_regex of alert %q: %v", compiled.Name, err) }
+		compiled.queueRegex = queueRegex
+	}
+	for _, clause := range strings.Split(strings.TrimSpace(rule.Condition), " and ") {
+		match := alertClauseRegex.FindStringSubmatch(strings.TrimSpace(clause))
+		if match == nil { return compiled, fmt.Errorf("invalid condition of alert %q: %q", compiled.Name, clause) }
+		threshold, err := strconv.ParseFloat(match[3], 64)
+		if err != nil { return compiled, fmt.Errorf("invalid condition of alert %q: %q", compiled.Name, clause) }
+		compiled.clauses = append(compiled.clauses, alertClause{match[1], match[2], threshold})
+	}
+	return compiled, nil
+}
+
+// All the clauses must be true, a clause on a metric the queue doesn't have is false
+func (r alertRule) matches(queue QueueSnapshot) bool {
+	if r.queueRegex != nil && !r.queueRegex.MatchString(queue.Queue) {
+		return false
+	}
+	for _, clause := range r.clauses {
+		value, ok := queue.Metrics[clause.metric]
+		if !ok || !clause.matches(value) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c alertClause) matches(value float64) bool {
+	switch c.operator {
+	case ">":
+		return value > c.threshold
+	case ">=":
+		return value >= c.threshold
+	case "<":
+		return value < c.threshold
+	case "<=":
+		return value <= c.threshold
+	case "==":
+		return value == c.threshold
+	}
+	return value != c.threshold
+}
+
+// Updates the state of the alerts with the queues of the last collection and returns the alerts that started
+// firing or were resolved. The alerts of the queues that are gone are resolved.
+func (e *AlertEvaluator) Evaluate(queues []QueueSnapshot, now time.Time) []AlertNotification {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	var notifications []AlertNotification
+	matched := make(map[alertKey]bool)
+	for i, rule := range e.rules {
+		for _, queue := range queues {
+			if !rule.matches(queue) { continue }
+			key := alertKey{i, queue.Vhost, queue.Queue}
+			matched[key] = true
+			state, ok := e.states[key]
+			if !ok {
+				state = &alertState{since: now}
+				e.states[key] = state
+			}
+			state.queue = queue
+			if !state.firing && now.Sub(state.since) >= rule.For {
+				state.firing = true
+				notifications = append(notifications, e.notification(key, state, nil))
+			}
+		}
+	}
+	for key, state := range e.states {
+		if matched[key] { continue }
+		delete(e.states, key)
+		if state.firing {
+			endsAt := now
+			notifications = append(notifications, e.notification(key, state, &endsAt))
+		}
+	}
+	sortAlerts(notifications)
+	return notifications
+}
+
+// Alerts firing after the last evaluation
+func (e *AlertEvaluator) Active() []AlertNotification {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	var active []AlertNotification
+	for key, state := range e.states {
+		if state.firing {
+			active = append(active, e.notification(key, state, nil))
+		}
+	}
+	sortAlerts(active)
+	return active
+}
+
+func (e *AlertEvaluator) notification(key alertKey, state *alertState, endsAt *time.Time) AlertNotification {
+	rule := e.rules[key.rule]
+	status := AlertFiring
+	if endsAt != nil {
+		status = AlertResolved
+	}
+	return AlertNotification{
+		Status: status,
+		Alert: rule.Name,
+		Condition: rule.Condition,
+		Queue: key.queue,
+		Vhost: key.vhost,
+		Metrics: state.queue.Metrics,
+		StartsAt: state.since,
+		EndsAt: endsAt,
+	}
+}
+
+func sortAlerts(alerts []AlertNotification) {
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Alert != alerts[j].Alert {
+			return alerts[i].Alert < alerts[j].Alert
+		}
+		if alerts[i].Vhost != alerts[j].Vhost {
+			return alerts[i].Vhost < alerts[j].Vhost
+		}
+		return alerts[i].Queue < alerts[j].Queue
+	})
+}
+
+// Queues the notifications for the webhook, they are dropped when the webhook is too slow to keep up
+func (e *AlertEvaluator) Notify(notifications []AlertNotification) {
+	for _, notification := range notifications {
+		log.Warnf("Alert %s %s for queue %s of vhost %s", notification.Alert, notification.Status, notification.Queue, notification.Vhost)
+	}
+	if e.Options.WebhookURL == "" || len(notifications) == 0 {
+		return
+	}
+	e.startSender.Do(func() { go e.sendNotifications() })
+	select {
+	case e.notifications <- notifications:
+	default:
+		log.Errorf("Alert webhook queue is full, %d notifications dropped", len(notifications))
+	}
+}
+
+func (e *AlertEvaluator) sendNotifications() {
+	for notifications := range e.notifications {
+		err := withRetries(e.Options.Retries, e.Options.RetryDelay, func() error {
+			return e.send(notifications)
+		})
+		if err != nil {
+			log.Errorf("Alert webhook failed: %v", err)
+		}
+	}
+}
+
+func (e *AlertEvaluator) send(notifications []AlertNotification) error {
+	body, err := json.Marshal(AlertWebhookPayload{Alerts: notifications})
+	if err != nil { return &permanentError{err} }
+	request, err := http.NewRequest(http.MethodPost, e.Options.WebhookURL, bytes.NewReader(body))
+	if err != nil { return &permanentError{err} }
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "rmq-console-exporter")
+	for name, value := range e.Options.Headers {
+		request.Header.Set(name, value)
+	}
+	response, err := e.HTTPClient.Do(request)
+	if err != nil { return err }
+	defer response.Body.Close()
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	if response.StatusCode / 100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("alert webhook returned %s: %s", response.Status, bytes.TrimSpace(message))
+	if response.StatusCode / 100 == 5 || response.StatusCode == http.StatusTooManyRequests {
+		return err
+	}
+	return &permanentError{err}
+}
@@ -0,0 +1,105 @@
+package exporters
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testQueue(name string, metrics map[string]float64) QueueSnapshot {
+	return QueueSnapshot{Queue: name, Vhost: "/", State: "running", Metrics: metrics}
+}
+
+func TestAlertEvaluate(t *testing.T) {
+	evaluator, err := NewAlertEvaluator(AlertOptions{Rules: []AlertRule{
+		{Name: "backlog", QueueRegex: "^orders", Condition: "messages_ready > 100", For: time.Minute},
+		{Condition: "consumers == 0 and messages_ready > 0"},
+	}})
+	assert.Nil(t, err)
+
+	start := time.Now()
+	queues := []QueueSnapshot{
+		testQueue("orders", map[string]float64{"messages_ready": 500, "consumers": 1}),
+		testQueue("billing", map[string]float64{"messages_ready": 500, "consumers": 0}),
+		testQueue("idle", map[string]float64{"messages_ready": 0, "consumers": 0}),
+	}
+	notifications := evaluator.Evaluate(queues, start)
+	assert.Equal(t, 1, len(notifications))
+	assert.Equal(t, AlertFiring, notifications[0].Status)
+	assert.Equal(t, "consumers == 0 and messages_ready > 0", notifications[0].Alert)
+	assert.Equal(t, "billing", notifications[0].Queue)
+
+	// The backlog is pending until it lasts one minute
+	notifications = evaluator.Evaluate(queues, start.Add(30 * time.Second))
+	assert.Empty(t, notifications)
+	notifications = evaluator.Evaluate(queues, start.Add(time.Minute))
+	assert.Equal(t, 1, len(notifications))
+	assert.Equal(t, "backlog", notifications[0].Alert)
+	assert.Equal(t, start, notifications[0].StartsAt)
+	assert.Equal(t, 2, len(evaluator.Active()))
+
+	// The alert of a queue that is gone is resolved
+	end := start.Add(2 * time.Minute)
+	notifications = evaluator.Evaluate(queues[:1], end)
+	assert.Equal(t, 1, len(notifications))
+	assert.Equal(t, AlertResolved, notifications[0].Status)
+	assert.Equal(t, "billing", notifications[0].Queue)
+	assert.Equal(t, &end, notifications[0].EndsAt)
+	assert.Equal(t, 1, len(evaluator.Active()))
+}
+
+func TestAlertInvalidRules(t *testing.T) {
+	for _, rule := range []AlertRule{
+		{Condition: "messages_ready >> 1"},
+		{Condition: "messages_ready > many"},
+		{Condition: "messages_ready > 1 and"},
+		{Condition: "messages_ready > 1", QueueRegex: "("},
+	} {
+		_, err := NewAlertEvaluator(AlertOptions{Rules: []AlertRule{rule}})
+		assert.NotNil(t, err, rule.Condition)
+	}
+}
+
+func TestAlertWebhook(t *testing.T) {
+	payloads := make(chan AlertWebhookPayload, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+		var payload AlertWebhookPayload
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&payload))
+		payloads <- payload
+	}))
+	defer server.Close()
+
+	evaluator, err := NewAlertEvaluator(AlertOptions{
+		WebhookURL: server.URL,
+		Headers: map[string]string{"X-Token": "secret"},
+		Rules: []AlertRule{{Name: "no_consumers", Condition: "consumers == 0"}},
+		Timeout: time.Second,
+	})
+	assert.Nil(t, err)
+	exporter := buildTestExporter([]ICollector{&queuesTestCollector{}})
+	exporter.Alerts = evaluator
+
+	expected := `
+		# HELP prefix_alert_active Alerts of the rules of the config file firing for a queue, the value is always 1.
+		# TYPE prefix_alert_active gauge
+		prefix_alert_active{alert="no_consumers",queue="orders.eu",vhost="/"} 1
+	`
+	assert.Nil(t, testutil.CollectAndCompare(exporter, strings.NewReader(expected), "prefix_alert_active"))
+
+	select {
+	case payload := <-payloads:
+		assert.Equal(t, 1, len(payload.Alerts))
+		assert.Equal(t, AlertFiring, payload.Alerts[0].Status)
+		assert.Equal(t, "orders.eu", payload.Alerts[0].Queue)
+		assert.Equal(t, map[string]float64{"messages_ready": 5, "consumers": 0}, payload.Alerts[0].Metrics)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the webhook was not called")
+	}
+}
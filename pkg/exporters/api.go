@@ -0,0 +1,125 @@
+package exporters
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+type QueuesResponse struct {
+	CollectedAt	time.Time		`json:"collected_at"`
+	// Number of queues matching the filters before the limit
+	Total		int				`json:"total"`
+	Queues		[]QueueSnapshot	`json:"queues"`
+}
+
+// Options of the /api/v1/queues endpoint
+type queuesQuery struct {
+	sort		string
+	descending	bool
+	queueRegex	*regexp.Regexp
+	vhost		string
+	state		string
+	limit		int
+}
+
+// Last snapshot of the queues as JSON, without running the collectors:
+// /api/v1/queues?sort=messages_ready&order=desc&queue_regex=^orders\..*$&vhost=/&state=running&limit=10
+func (p *PrometheusExporter) ServeQueues(w http.ResponseWriter, r *http.Request) {
+	query, err := parseQueuesQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	queues, collectedAt := p.Snapshots.Queues()
+	if collectedAt.IsZero() {
+		http.Error(w, "no collection has finished yet", http.StatusServiceUnavailable)
+		return
+	}
+
+	response := QueuesResponse{CollectedAt: collectedAt, Queues: query.apply(queues)}
+	response.Total = len(response.Queues)
+	if query.limit > 0 && len(response.Queues) > query.limit {
+		response.Queues = response.Queues[:query.limit]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Errorf("Error writing the queues: %v", err)
+	}
+}
+
+func parseQueuesQuery(params url.Values) (*queuesQuery, error) {
+	query := &queuesQuery{sort: "queue", vhost: params.Get("vhost"), state: params.Get("state")}
+	if sortField := params.Get("sort"); sortField != "" {
+		query.sort = sortField
+	}
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.descending = true
+	default:
+		return nil, fmt.Errorf("invalid order %q, it must be asc or desc", params.Get("order"))
+	}
+	if queueRegex := params.Get("queue_regex"); queueRegex != "" {
+		regex, err := regexp.Compile(queueRegex)
+		if err != nil { return nil, fmt.Errorf("invalid queue_regex: %v", err) }
+		query.queueRegex = regex
+	}
+	if limit := params.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 0 { return nil, fmt.Errorf("invalid limit %q", limit) }
+		query.limit = value
+	}
+	return query, nil
+}
+
+// Filters and sorts the queues, the queues without the sort metric go last and the ties are sorted by vhost and name
+func (q *queuesQuery) apply(queues []QueueSnapshot) []QueueSnapshot {
+	filtered := make([]QueueSnapshot, 0, len(queues))
+	for _, queue := range queues {
+		if q.queueRegex != nil && !q.queueRegex.MatchString(queue.Queue) { continue }
+		if q.vhost != "" && queue.Vhost != q.vhost { continue }
+		if q.state != "" && queue.State != q.state { continue }
+		filtered = append(filtered, queue)
+	}
+
+	sort.SliceStable(filtered, func(i, j int) bool {
+		a, b := filtered[i], filtered[j]
+		if q.sort == "queue" || q.sort == "vhost" || q.sort == "state" {
+			fieldA, fieldB := a.field(q.sort), b.field(q.sort)
+			if fieldA != fieldB {
+				return (fieldA < fieldB) != q.descending
+			}
+		} else {
+			valueA, okA := a.Metrics[q.sort]
+			valueB, okB := b.Metrics[q.sort]
+			if okA != okB {
+				return okA
+			}
+			if valueA != valueB {
+				return (valueA < valueB) != q.descending
+			}
+		}
+		if a.Vhost != b.Vhost {
+			return a.Vhost < b.Vhost
+		}
+		return a.Queue < b.Queue
+	})
+	return filtered
+}
+
+func (q QueueSnapshot) field(name string) string {
+	switch name {
+	case "vhost":
+		return q.Vhost
+	case "state":
+		return q.State
+	}
+	return q.Queue
+}
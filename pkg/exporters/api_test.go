@@ -0,0 +1,139 @@
+package exporters
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type queueTestMetrics struct {
+	queue	string
+	values	map[string]float64
+}
+
+func (m queueTestMetrics) GetMetricValue(name string) (float64, error) {
+	value, ok := m.values[name]
+	if !ok {
+		return 0.0, errors.New("metric not found")
+	}
+	return value, nil
+}
+
+func (m queueTestMetrics) GetLabels(name string) (map[string]string, error) {
+	if _, ok := m.values[name]; !ok {
+		return nil, errors.New("metric not found")
+	}
+	return map[string]string{"queue": m.queue, "state": "running"}, nil
+}
+
+type queuesTestCollector struct {
+	vhost	string
+	err		error
+}
+
+func (c *queuesTestCollector) GetVhost() string {
+	return c.vhost
+}
+
+func (c *queuesTestCollector) Collect() ([]IMetrics, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return []IMetrics{
+		queueTestMetrics{"orders.eu", map[string]float64{"messages_ready": 5, "consumers": 0}},
+		queueTestMetrics{"orders.us", map[string]float64{"messages_ready": 12, "consumers": 2}},
+		queueTestMetrics{"billing", map[string]float64{"messages_ready": 1, "consumers": 1}},
+	}, nil
+}
+
+func getQueues(t *testing.T, exporter *PrometheusExporter, query string) (int, QueuesResponse) {
+	recorder := httptest.NewRecorder()
+	exporter.ServeQueues(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/queues" + query, nil))
+	var response QueuesResponse
+	if recorder.Code == http.StatusOK {
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	}
+	return recorder.Code, response
+}
+
+func queueNames(response QueuesResponse) []string {
+	var names []string
+	for _, queue := range response.Queues {
+		names = append(names, queue.Queue)
+	}
+	return names
+}
+
+func TestServeQueues(t *testing.T) {
+	exporter := buildTestExporter([]ICollector{&queuesTestCollector{vhost: "shop"}})
+	code, _ := getQueues(t, exporter, "")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	_, err := exporter.Gather()
+	assert.Nil(t, err)
+
+	code, response := getQueues(t, exporter, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 3, response.Total)
+	assert.False(t, response.CollectedAt.IsZero())
+	assert.Equal(t, []string{"billing", "orders.eu", "orders.us"}, queueNames(response))
+	assert.Equal(t, QueueSnapshot{
+		Queue: "billing",
+		Vhost: "shop",
+		State: "running",
+		Metrics: map[string]float64{"messages_ready": 1, "consumers": 1},
+	}, response.Queues[0])
+
+	_, response = getQueues(t, exporter, "?sort=messages_ready&order=desc&limit=2")
+	assert.Equal(t, 3, response.Total)
+	assert.Equal(t, []string{"orders.us", "orders.eu"}, queueNames(response))
+
+	_, response = getQueues(t, exporter, "?queue_regex=^orders&sort=consumers")
+	assert.Equal(t, 2, response.Total)
+	assert.Equal(t, []string{"orders.eu", "orders.us"}, queueNames(response))
+
+	_, response = getQueues(t, exporter, "?vhost=/")
+	assert.Equal(t, 0, response.Total)
+	assert.Empty(t, response.Queues)
+}
+
+func TestServeQueuesInvalidQuery(t *testing.T) {
+	exporter := buildTestExporter([]ICollector{&queuesTestCollector{}})
+	for _, query := range []string{"?order=up", "?limit=-1", "?limit=ten", "?queue_regex=("} {
+		code, _ := getQueues(t, exporter, query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+}
+
+func TestSnapshotKeptOnFailure(t *testing.T) {
+	collector := &queuesTestCollector{}
+	exporter := buildTestExporter([]ICollector{collector})
+	_, err := exporter.Gather()
+	assert.Nil(t, err)
+
+	collector.err = errors.New("node down")
+	_, err = exporter.Gather()
+	assert.NotNil(t, err)
+
+	_, response := getQueues(t, exporter, "")
+	assert.Equal(t, 3, response.Total)
+	assert.Equal(t, "/", response.Queues[0].Vhost)
+	collections := exporter.Snapshots.Collections()
+	assert.Equal(t, 1, len(collections))
+	assert.Equal(t, "node down", collections[0].Error)
+	assert.True(t, collections[0].LastAttempt.After(collections[0].LastSuccess))
+}
+
+func TestFilteredScrapeSkipsSnapshot(t *testing.T) {
+	exporter := buildTestExporter([]ICollector{&MockedNamedCollector{}})
+	scrape, err := exporter.scrapeExporter(map[string][]string{"queue_regex": {"^q"}})
+	assert.Nil(t, err)
+	assert.Nil(t, scrape.Snapshots)
+
+	scrape, err = exporter.scrapeExporter(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, exporter.Snapshots, scrape.Snapshots)
+}
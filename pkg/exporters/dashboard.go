@@ -0,0 +1,36 @@
+package exporters
+
+import (
+	_ "embed"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+)
+
+//go:embed dashboard.html
+var dashboardHTML []byte
+
+type CollectorsResponse struct {
+	Collectors	[]CollectionSnapshot	`json:"collectors"`
+}
+
+// Page with the heaviest queues and the status of the collectors, it only reads the snapshot of /api/v1/queues
+// and /api/v1/collectors so it doesn't run the collectors
+func (p *PrometheusExporter) ServeDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(dashboardHTML); err != nil {
+		log.Errorf("Error writing the dashboard: %v", err)
+	}
+}
+
+// Result of the last collection of every collector
+func (p *PrometheusExporter) ServeCollectors(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(CollectorsResponse{Collectors: p.Snapshots.Collections()}); err != nil {
+		log.Errorf("Error writing the collectors: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package exporters
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeDashboard(t *testing.T) {
+	exporter := buildTestExporter([]ICollector{&queuesTestCollector{}})
+	recorder := httptest.NewRecorder()
+	exporter.ServeDashboard(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.True(t, strings.Contains(recorder.Body.String(), "api/v1/queues?"))
+
+	recorder = httptest.NewRecorder()
+	exporter.ServeDashboard(recorder, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestServeCollectors(t *testing.T) {
+	exporter := buildTestExporter([]ICollector{&queuesTestCollector{err: errors.New("node down")}})
+	_, err := exporter.Gather()
+	assert.NotNil(t, err)
+
+	recorder := httptest.NewRecorder()
+	exporter.ServeCollectors(recorder, httptest.NewRequest(http.MethodGet, "/api/v1/collectors", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var response CollectorsResponse
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	assert.Equal(t, 1, len(response.Collectors))
+	assert.Equal(t, "*exporters.queuesTestCollector", response.Collectors[0].Collector)
+	assert.Equal(t, "node down", response.Collectors[0].Error)
+	assert.True(t, response.Collectors[0].LastSuccess.IsZero())
+}
@@ -0,0 +1,116 @@
+package exporters
+
+import (
+	"fmt"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Safe size for UDP packets on ethernet networks (1500 MTU minus IP and UDP headers)
+	defaultDogStatsDPacketSize	= 1432
+	// The Datadog agent reads up to 8KB per datagram on Unix domain sockets
+	defaultDogStatsDUDSPacketSize	= 8192
+)
+
+// Options of the DogStatsD agent set in the dogstatsd table of the config file
+type DogStatsDOptions struct {
+	// host:port for UDP or unix:///path/to/dsd.socket for UDS
+	Address			string
+	Tags			[]string
+	PacketSize		int
+	Timeout			time.Duration
+	// Prefix of the DogStatsD metrics, it replaces the prefix of the exporter (-prefix)
+	Prefix			string
+	ExporterPrefix	string
+}
+
+// Sends the metrics of every collection as DogStatsD gauges to a Datadog agent, the labels are sent as tags.
+// Several metrics are sent in every packet (one per line) without going over the packet size.
+type DogStatsDSender struct {
+	Options	DogStatsDOptions
+	// Metrics that didn't fit in a packet since the start, they are skipped instead of failing the push
+	Skipped	int
+	network	string
+	address	string
+}
+
+func NewDogStatsDSender(options DogStatsDOptions) (*DogStatsDSender, error) {
+	sender := &DogStatsDSender{Options: options, network: "udp", address: options.Address}
+	defaultPacketSize := defaultDogStatsDPacketSize
+	if strings.HasPrefix(options.Address, "unix://") {
+		sender.network = "unixgram"
+		sender.address = strings.TrimPrefix(options.Address, "unix://")
+		defaultPacketSize = defaultDogStatsDUDSPacketSize
+	} else if _, _, err := net.SplitHostPort(options.Address); err != nil {
+		return nil, fmt.Errorf("invalid DogStatsD address %q: %v", options.Address, err)
+	}
+	if sender.Options.PacketSize <= 0 {
+		sender.Options.PacketSize = defaultPacketSize
+	}
+	return sender, nil
+}
+
+func (s *DogStatsDSender) GetName() string {
+	return s.Options.Address
+}
+
+// The metrics have the prefix of the exporter (-prefix), it's replaced by the one of the DogStatsD options
+func (s *DogStatsDSender) Push(families []*dto.MetricFamily) error {
+	connection, err := net.DialTimeout(s.network, s.address, s.Options.Timeout)
+	if err != nil { return err }
+	defer connection.Close()
+
+	var packet []byte
+	for _, sample := range Samples(families) {
+		sample.Name = s.Options.Prefix + strings.TrimPrefix(sample.Name, s.Options.ExporterPrefix)
+		line := formatDogStatsD(sample, s.Options.Tags)
+		if len(line) > s.Options.PacketSize {
+			s.Skipped++
+			log.Warnf("Skipping metric %s, it doesn't fit in a packet of %d bytes (%d skipped)", sample.Name, s.Options.PacketSize, s.Skipped)
+			continue
+		}
+		if len(packet) > 0 && len(packet) + 1 + len(line) > s.Options.PacketSize {
+			if _, err := connection.Write(packet); err != nil { return err }
+			packet = packet[:0]
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		if _, err := connection.Write(packet); err != nil { return err }
+	}
+	return nil
+}
+
+// <name>:<value>|g|#<tag>:<value>,... with the tags sorted, the characters used by the protocol in the tags
+// (| , and new lines) are replaced by _
+func formatDogStatsD(sample MetricSample, globalTags []string) string {
+	tags := append([]string{}, globalTags...)
+	names := make([]string, 0, len(sample.Labels))
+	for name := range sample.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tags = append(tags, name + ":" + sample.Labels[name])
+	}
+
+	line := sample.Name + ":" + strconv.FormatFloat(sample.Value, 'f', -1, 64) + "|g"
+	if len(tags) == 0 {
+		return line
+	}
+	for i, tag := range tags {
+		tags[i] = dogStatsDTagReplacer.Replace(tag)
+	}
+	return line + "|#" + strings.Join(tags, ",")
+}
+
+var dogStatsDTagReplacer = strings.NewReplacer("|", "_", ",", "_", "\n", "_", "\r", "_")
@@ -0,0 +1,86 @@
+package exporters
+
+import (
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatDogStatsD(t *testing.T) {
+	sample := MetricSample{Name: "rmq_memory", Labels: map[string]string{"state": "{syncing, 5}", "queue": "q|1"}, Value: 1.5}
+	assert.Equal(t, "rmq_memory:1.5|g|#env:prod,queue:q_1,state:{syncing_ 5}", formatDogStatsD(sample, []string{"env:prod"}))
+	assert.Equal(t, "rmq_up:1|g", formatDogStatsD(MetricSample{Name: "rmq_up", Value: 1}, nil))
+}
+
+func readPackets(t *testing.T, connection net.PacketConn) []string {
+	var packets []string
+	buffer := make([]byte, 65536)
+	for {
+		_ = connection.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := connection.ReadFrom(buffer)
+		if err != nil {
+			return packets
+		}
+		packets = append(packets, string(buffer[:n]))
+	}
+}
+
+func TestDogStatsDPushUDP(t *testing.T) {
+	connection, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer connection.Close()
+
+	families := testFamilies(t)
+	families = append(families, families...)
+	line := "prefix_memory:1.5|g|#queue:q33,state:running"
+	// Two metrics don't fit in one packet
+	sender, err := NewDogStatsDSender(DogStatsDOptions{Address: connection.LocalAddr().String(), PacketSize: len(line) + 1})
+	assert.Nil(t, err)
+	assert.Nil(t, sender.Push(families))
+	assert.Equal(t, []string{line, line}, readPackets(t, connection))
+
+	sender.Options.PacketSize = 2 * len(line) + 1
+	assert.Nil(t, sender.Push(families))
+	assert.Equal(t, []string{line + "\n" + line}, readPackets(t, connection))
+
+	// The metrics that don't fit in a packet are skipped, the others are sent
+	sender.Options.PacketSize = 10
+	assert.Nil(t, sender.Push(families))
+	assert.Equal(t, 2, sender.Skipped)
+	name, value := "prefix_up", 1.0
+	families = append(testFamilies(t), &dto.MetricFamily{Name: &name, Type: dto.MetricType_GAUGE.Enum(),
+		Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: &value}}}})
+	sender.Options.PacketSize = 20
+	assert.Nil(t, sender.Push(families))
+	assert.Equal(t, 3, sender.Skipped)
+	assert.Equal(t, []string{"prefix_up:1|g"}, readPackets(t, connection))
+
+	// The prefix of the exporter is replaced
+	sender.Options = DogStatsDOptions{Address: sender.Options.Address, PacketSize: 1432, Prefix: "rabbitmq.", ExporterPrefix: "prefix_"}
+	assert.Nil(t, sender.Push(testFamilies(t)))
+	assert.Equal(t, []string{"rabbitmq.memory:1.5|g|#queue:q33,state:running"}, readPackets(t, connection))
+}
+
+func TestDogStatsDPushUDS(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "dsd.socket")
+	connection, err := net.ListenPacket("unixgram", socket)
+	assert.Nil(t, err)
+	defer connection.Close()
+
+	sender, err := NewDogStatsDSender(DogStatsDOptions{Address: "unix://" + socket, Tags: []string{"env:prod"}})
+	assert.Nil(t, err)
+	assert.Equal(t, defaultDogStatsDUDSPacketSize, sender.Options.PacketSize)
+	assert.Nil(t, sender.Push(testFamilies(t)))
+	packets := readPackets(t, connection)
+	assert.Equal(t, 1, len(packets))
+	assert.True(t, strings.HasPrefix(packets[0], "prefix_memory:1.5|g|#env:prod,"))
+}
+
+func TestDogStatsDInvalidAddress(t *testing.T) {
+	_, err := NewDogStatsDSender(DogStatsDOptions{Address: "localhost"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,228 @@
+package exporters
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"strings"
+)
+
+type ruleFile struct {
+	Groups	[]ruleGroup	`yaml:"groups"`
+}
+
+type ruleGroup struct {
+	Name	string			`yaml:"name"`
+	Rules	[]alertingRule	`yaml:"rules"`
+}
+
+type alertingRule struct {
+	Alert		string				`yaml:"alert"`
+	Expr		string				`yaml:"expr"`
+	For			string				`yaml:"for,omitempty"`
+	Labels		map[string]string	`yaml:"labels,omitempty"`
+	Annotations	map[string]string	`yaml:"annotations,omitempty"`
+}
+
+// Names of the exported metrics by key, the first key that is not a metric of the exporter is kept in err so the
+// generated files can't refer to metrics that don't exist
+type metricNames struct {
+	prefix		string
+	metrics		map[string]MetricDefinition
+	err			error
+}
+
+func newMetricNames(prefix string) *metricNames {
+	names := &metricNames{prefix: prefix, metrics: make(map[string]MetricDefinition)}
+	for _, metric := range MetricDefinitions(QueueMetricLabels) {
+		names.metrics[metric.Key] = metric
+	}
+	return names
+}
+
+func (n *metricNames) name(key string) string {
+	metric, ok := n.metrics[key]
+	if !ok {
+		if n.err == nil { n.err = fmt.Errorf("unknown metric %q", key) }
+		return ""
+	}
+	return n.prefix + metric.Name
+}
+
+// Recommended Prometheus alerting rules for the metrics of the exporter with the prefix
+func GenerateRules(prefix string) ([]byte, error) {
+	n := newMetricNames(prefix)
+	warning := map[string]string{"severity": "warning"}
+	critical := map[string]string{"severity": "critical"}
+	queueRules := []alertingRule{
+		{
+			Alert: "RabbitMQQueueBacklog",
+			Expr: n.name("messages_ready") + " > 10000",
+			For: "15m",
+			Labels: warning,
+			Annotations: map[string]string{"summary": "Queue {{ $labels.queue }} has {{ $value }} messages ready for 15 minutes."},
+		},
+		{
+			Alert: "RabbitMQQueueWithoutConsumers",
+			Expr: n.name("consumers") + " == 0 and " + n.name("messages_ready") + " > 0",
+			For: "10m",
+			Labels: warning,
+			Annotations: map[string]string{"summary": "Queue {{ $labels.queue }} has messages but no consumers."},
+		},
+		{
+			Alert: "RabbitMQQueueUnacknowledgedMessages",
+			Expr: n.name("messages_unacknowledged") + " > 1000",
+			For: "15m",
+			Labels: warning,
+			Annotations: map[string]string{"summary": "Queue {{ $labels.queue }} has {{ $value }} unacknowledged messages."},
+		},
+		{
+			Alert: "RabbitMQQueueMemory",
+			Expr: n.name("memory") + " > 100 * 1024 * 1024",
+			For: "15m",
+			Labels: warning,
+			Annotations: map[string]string{"summary": "Queue {{ $labels.queue }} uses {{ $value | humanize1024 }}B of memory."},
+		},
+		{
+			Alert: "RabbitMQCollectionSlow",
+			Expr: n.name("command_runtime") + " > 60",
+			For: "15m",
+			Labels: warning,
+			Annotations: map[string]string{"summary": "Collecting the metrics with {{ $labels.command_executed }} takes {{ $value }}s."},
+		},
+	}
+	// Only exported with the management API source
+	nodeRules := []alertingRule{
+		{
+			Alert: "RabbitMQNodeDown",
+			Expr: n.name("node_running") + " == 0",
+			For: "5m",
+			Labels: critical,
+			Annotations: map[string]string{"summary": "Node {{ $labels.node }} is not running."},
+		},
+		{
+			Alert: "RabbitMQNodeMemoryHigh",
+			Expr: n.name("node_mem_used") + " / " + n.name("node_mem_limit") + " > 0.9",
+			For: "5m",
+			Labels: warning,
+			Annotations: map[string]string{"summary": "Node {{ $labels.node }} uses {{ $value | humanizePercentage }} of its memory high watermark."},
+		},
+		{
+			Alert: "RabbitMQNodeDiskFreeLow",
+			Expr: n.name("node_disk_free") + " < 2 * " + n.name("node_disk_free_limit"),
+			For: "5m",
+			Labels: warning,
+			Annotations: map[string]string{"summary": "Node {{ $labels.node }} is close to the disk free limit."},
+		},
+		{
+			Alert: "RabbitMQNodeFileDescriptors",
+			Expr: n.name("node_fd_used") + " / " + n.name("node_fd_total") + " > 0.9",
+			For: "5m",
+			Labels: warning,
+			Annotations: map[string]string{"summary": "Node {{ $labels.node }} uses {{ $value | humanizePercentage }} of its file descriptors."},
+		},
+	}
+	if n.err != nil { return nil, n.err }
+	return yaml.Marshal(ruleFile{Groups: []ruleGroup{
+		{Name: "rmq-console-exporter-queues", Rules: queueRules},
+		{Name: "rmq-console-exporter-nodes", Rules: nodeRules},
+	}})
+}
+
+// Grafana dashboard with a time series panel per metric of the exporter, grouped in rows by kind of metric
+func GenerateDashboard(prefix string) ([]byte, error) {
+	rows := []struct {
+		title	string
+		label	string
+		query	string
+	}{
+		{"Queues", "queue", `topk(10, %s{queue=~"$queue"})`},
+		{"Nodes", "node", "%s"},
+		{"Cluster", "cluster_name", "%s"},
+	}
+	n := newMetricNames(prefix)
+	var panels []map[string]interface{}
+	id := 1
+	y := 0
+	for _, row := range rows {
+		panels = append(panels, map[string]interface{}{
+			"id": id,
+			"type": "row",
+			"title": row.title,
+			"collapsed": false,
+			"gridPos": map[string]int{"h": 1, "w": 24, "x": 0, "y": y},
+			"panels": []interface{}{},
+		})
+		id++
+		y++
+		x := 0
+		for _, metric := range MetricDefinitions(QueueMetricLabels) {
+			if len(metric.Labels) == 0 || metric.Labels[0] != row.label { continue }
+			panels = append(panels, dashboardPanel(id, prefix + metric.Name, metric.Help, fmt.Sprintf(row.query, prefix + metric.Name), "{{" + row.label + "}}", x, y))
+			id++
+			if x += 12; x == 24 {
+				x = 0
+				y += 8
+			}
+		}
+		if x != 0 {
+			y += 8
+		}
+	}
+	panels = append(panels, map[string]interface{}{
+		"id": id,
+		"type": "row",
+		"title": "Agent",
+		"collapsed": false,
+		"gridPos": map[string]int{"h": 1, "w": 24, "x": 0, "y": y},
+		"panels": []interface{}{},
+	})
+	runtime := n.name("command_runtime")
+	panels = append(panels, dashboardPanel(id + 1, runtime, n.metrics["command_runtime"].Help, runtime, "{{command_executed}}", 0, y + 1))
+
+	dashboard := map[string]interface{}{
+		"title": "RabbitMQ queues (" + strings.TrimSuffix(prefix, "_") + ")",
+		"uid": "rmq-console-exporter-" + strings.TrimSuffix(prefix, "_"),
+		"tags": []string{"rabbitmq", "rmq-console-exporter"},
+		"schemaVersion": 27,
+		"editable": true,
+		"refresh": "1m",
+		"time": map[string]string{"from": "now-6h", "to": "now"},
+		"templating": map[string]interface{}{"list": []interface{}{
+			map[string]interface{}{
+				"name": "datasource",
+				"type": "datasource",
+				"query": "prometheus",
+				"label": "Data source",
+			},
+			map[string]interface{}{
+				"name": "queue",
+				"type": "query",
+				"datasource": "$datasource",
+				"query": "label_values(" + n.name("messages_ready") + ", queue)",
+				"refresh": 2,
+				"includeAll": true,
+				"multi": true,
+				"allValue": ".*",
+				"current": map[string]interface{}{"text": "All", "value": "$__all"},
+			},
+		}},
+		"panels": panels,
+	}
+	if n.err != nil { return nil, n.err }
+	return json.MarshalIndent(dashboard, "", "  ")
+}
+
+func dashboardPanel(id int, title string, description string, expr string, legend string, x int, y int) map[string]interface{} {
+	return map[string]interface{}{
+		"id": id,
+		"type": "timeseries",
+		"title": title,
+		"description": description,
+		"datasource": "$datasource",
+		"gridPos": map[string]int{"h": 8, "w": 12, "x": x, "y": y},
+		"targets": []interface{}{
+			map[string]interface{}{"expr": expr, "legendFormat": legend, "refId": "A"},
+		},
+	}
+}
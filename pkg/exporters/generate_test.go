@@ -0,0 +1,77 @@
+package exporters
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	"regexp"
+	"testing"
+)
+
+// The generated files only refer to metrics exported with the prefix
+func exportedNames(prefix string) map[string]bool {
+	names := make(map[string]bool)
+	for _, metric := range MetricDefinitions(QueueMetricLabels) {
+		names[prefix + metric.Name] = true
+	}
+	return names
+}
+
+var generatedMetric = regexp.MustCompile(`\btest_[a-z_]+`)
+
+func TestGenerateRules(t *testing.T) {
+	content, err := GenerateRules("test_")
+	assert.Nil(t, err)
+	var rules ruleFile
+	assert.Nil(t, yaml.Unmarshal(content, &rules))
+	assert.Equal(t, 2, len(rules.Groups))
+
+	names := exportedNames("test_")
+	for _, group := range rules.Groups {
+		for _, rule := range group.Rules {
+			metrics := generatedMetric.FindAllString(rule.Expr, -1)
+			assert.NotEmpty(t, metrics, rule.Alert)
+			for _, metric := range metrics {
+				assert.True(t, names[metric], "%s uses unknown metric %s", rule.Alert, metric)
+			}
+		}
+	}
+}
+
+func TestGenerateDashboard(t *testing.T) {
+	content, err := GenerateDashboard("test_")
+	assert.Nil(t, err)
+	var dashboard struct {
+		Panels	[]struct {
+			Type	string
+			Title	string
+			Targets	[]struct {
+				Expr	string
+			}
+		}
+	}
+	assert.Nil(t, json.Unmarshal(content, &dashboard))
+
+	names := exportedNames("test_")
+	panels := make(map[string]bool)
+	for _, panel := range dashboard.Panels {
+		if panel.Type == "row" { continue }
+		panels[panel.Title] = true
+		assert.Equal(t, 1, len(panel.Targets))
+		for _, metric := range generatedMetric.FindAllString(panel.Targets[0].Expr, -1) {
+			assert.True(t, names[metric], "%s uses unknown metric %s", panel.Title, metric)
+		}
+	}
+	// All the metrics but the version info have a panel
+	delete(names, "test_rabbitmq_version_info")
+	assert.Equal(t, names, panels)
+}
+
+func TestGenerateUnknownMetric(t *testing.T) {
+	n := newMetricNames("test_")
+	assert.Equal(t, "test_messages_ready", n.name("messages_ready"))
+	assert.Nil(t, n.err)
+	assert.Equal(t, "", n.name("messages_lost"))
+	assert.Equal(t, "", n.name("consumers_lost"))
+	assert.EqualError(t, n.err, `unknown metric "messages_lost"`)
+}
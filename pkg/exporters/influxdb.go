@@ -0,0 +1,126 @@
+package exporters
+
+import (
+	"bytes"
+	"fmt"
+	dto "github.com/prometheus/client_model/go"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const OutputInflux = "influx"
+
+// Options of InfluxDB set in the influxdb table of the config file, the lines are sent to the url or written to
+// stdout, not both
+type InfluxDBOptions struct {
+	URL			string
+	Stdout		bool
+	Org			string
+	Bucket		string
+	Token		string
+	Retries		int
+	RetryDelay	time.Duration
+	Timeout		time.Duration
+}
+
+// Writes the metrics of every collection in the InfluxDB line protocol to the /api/v2/write endpoint or to a
+// writer (e.g. stdout for Telegraf's execd input)
+type InfluxDBWriter struct {
+	Options		InfluxDBOptions
+	Output		io.Writer
+	HTTPClient	*http.Client
+}
+
+func NewInfluxDBWriter(options InfluxDBOptions) (*InfluxDBWriter, error) {
+	if options.URL != "" && options.Stdout {
+		return nil, fmt.Errorf("the InfluxDB url and stdout can't be both set")
+	}
+	return &InfluxDBWriter{
+		Options: options,
+		Output: os.Stdout,
+		HTTPClient: &http.Client{Timeout: options.Timeout},
+	}, nil
+}
+
+func (w *InfluxDBWriter) GetName() string {
+	if w.Options.URL == "" {
+		return "stdout"
+	}
+	return w.Options.URL
+}
+
+func (w *InfluxDBWriter) Push(families []*dto.MetricFamily) error {
+	var lines bytes.Buffer
+	if err := writeInfluxLines(&lines, Samples(families), time.Now()); err != nil { return err }
+	if w.Options.URL == "" {
+		_, err := w.Output.Write(lines.Bytes())
+		return err
+	}
+	return withRetries(w.Options.Retries, w.Options.RetryDelay, func() error {
+		return w.send(lines.Bytes())
+	})
+}
+
+func (w *InfluxDBWriter) send(body []byte) error {
+	writeURL, err := url.Parse(strings.TrimSuffix(w.Options.URL, "/") + "/api/v2/write")
+	if err != nil { return err }
+	writeURL.RawQuery = url.Values{"org": {w.Options.Org}, "bucket": {w.Options.Bucket}, "precision": {"ns"}}.Encode()
+
+	request, err := http.NewRequest(http.MethodPost, writeURL.String(), bytes.NewReader(body))
+	if err != nil { return err }
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if w.Options.Token != "" {
+		request.Header.Set("Authorization", "Token " + w.Options.Token)
+	}
+	response, err := w.HTTPClient.Do(request)
+	if err != nil { return err }
+	defer response.Body.Close()
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	if response.StatusCode / 100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("InfluxDB returned %s: %s", response.Status, bytes.TrimSpace(message))
+	if response.StatusCode / 100 == 5 || response.StatusCode == http.StatusTooManyRequests {
+		return err
+	}
+	return &permanentError{err}
+}
+
+// One line per sample: <metric>,<label>=<value>,... value=<value> <timestamp>
+// The labels are sorted and the empty ones are skipped since InfluxDB doesn't accept empty tags, neither NaN
+// or infinite values. New lines can't be escaped in the line protocol, they are replaced by spaces.
+func writeInfluxLines(w io.Writer, samples []MetricSample, timestamp time.Time) error {
+	nanoseconds := strconv.FormatInt(timestamp.UnixNano(), 10)
+	for _, sample := range samples {
+		if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) { continue }
+		names := make([]string, 0, len(sample.Labels))
+		for name, value := range sample.Labels {
+			if value != "" {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		var line strings.Builder
+		line.WriteString(influxMeasurementReplacer.Replace(sample.Name))
+		for _, name := range names {
+			line.WriteString("," + influxTagReplacer.Replace(name) + "=" + influxTagReplacer.Replace(sample.Labels[name]))
+		}
+		line.WriteString(" value=" + strconv.FormatFloat(sample.Value, 'g', -1, 64) + " " + nanoseconds + "\n")
+		if _, err := io.WriteString(w, line.String()); err != nil { return err }
+	}
+	return nil
+}
+
+var (
+	influxMeasurementReplacer = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\ `, "\r", `\ `)
+	influxTagReplacer = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `, "\r", `\ `)
+)
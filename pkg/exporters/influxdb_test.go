@@ -0,0 +1,64 @@
+package exporters
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteInfluxLines(t *testing.T) {
+	samples := []MetricSample{
+		{Name: "rmq_memory", Labels: map[string]string{"state": "{syncing, 5}", "queue": "a,b=c"}, Value: 1.5},
+		{Name: "rmq_head_message_timestamp", Labels: map[string]string{"queue": "q1", "state": ""}, Value: 1630920836},
+		{Name: "rmq_consumer_utilisation", Labels: map[string]string{"queue": "q1"}, Value: math.NaN()},
+		{Name: "rmq_messages_ready", Labels: map[string]string{"queue": "q\r\n1"}, Value: 2},
+	}
+	var output bytes.Buffer
+	assert.Nil(t, writeInfluxLines(&output, samples, time.Unix(1630920836, 5)))
+	expected := `rmq_memory,queue=a\,b\=c,state={syncing\,\ 5} value=1.5 1630920836000000005` + "\n" +
+		"rmq_head_message_timestamp,queue=q1 value=1.630920836e+09 1630920836000000005\n" +
+		`rmq_messages_ready,queue=q\ \ 1 value=2 1630920836000000005` + "\n"
+	assert.Equal(t, expected, output.String())
+}
+
+func TestInfluxDBPushHTTP(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v2/write", r.URL.Path)
+		assert.Equal(t, "org1", r.URL.Query().Get("org"))
+		assert.Equal(t, "rabbitmq", r.URL.Query().Get("bucket"))
+		assert.Equal(t, "ns", r.URL.Query().Get("precision"))
+		assert.Equal(t, "Token secret", r.Header.Get("Authorization"))
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	writer, err := NewInfluxDBWriter(InfluxDBOptions{URL: server.URL, Org: "org1", Bucket: "rabbitmq", Token: "secret"})
+	assert.Nil(t, err)
+	assert.Nil(t, writer.Push(testFamilies(t)))
+	assert.Equal(t, 1, len(bodies))
+	assert.True(t, strings.HasPrefix(bodies[0], "prefix_memory,queue=q33,state=running value=1.5 "))
+}
+
+func TestInfluxDBPushStdout(t *testing.T) {
+	var output bytes.Buffer
+	writer, err := NewInfluxDBWriter(InfluxDBOptions{Stdout: true})
+	assert.Nil(t, err)
+	writer.Output = &output
+	assert.Equal(t, "stdout", writer.GetName())
+	assert.Nil(t, writer.Push(testFamilies(t)))
+	assert.True(t, strings.HasPrefix(output.String(), "prefix_memory,queue=q33,state=running value=1.5 "))
+}
+
+func TestInfluxDBInvalidOptions(t *testing.T) {
+	_, err := NewInfluxDBWriter(InfluxDBOptions{URL: "http://influxdb.example.com:8086", Stdout: true})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,261 @@
+package exporters
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	OTLPProtocolGRPC	= "grpc"
+	OTLPProtocolHTTP	= "http"
+
+	otlpGRPCPath	= "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	otlpHTTPPath	= "/v1/metrics"
+	otlpScopeName	= "rmq-console-exporter"
+)
+
+// Options of the OTLP endpoint set in the otlp table of the config file
+type OTLPOptions struct {
+	Endpoint			string
+	Protocol			string
+	Headers				map[string]string
+	ResourceAttributes	map[string]string
+	CAFile				string
+	CertFile			string
+	KeyFile				string
+	InsecureSkipVerify	bool
+	Retries				int
+	RetryDelay			time.Duration
+	Timeout				time.Duration
+}
+
+// Sends the metrics of every collection as OTel gauges to an OpenTelemetry collector with OTLP over HTTP
+// (protobuf, default) or gRPC. The messages are encoded by hand to avoid the OTel SDK, gRPC is only supported
+// over TLS since it needs HTTP/2 and plaintext HTTP/2 (h2c) is not available in net/http.
+type OTLPExporter struct {
+	Options		OTLPOptions
+	URL			string
+	HTTPClient	*http.Client
+}
+
+func NewOTLPExporter(options OTLPOptions) (*OTLPExporter, error) {
+	if options.Protocol == "" {
+		options.Protocol = OTLPProtocolHTTP
+	}
+	tlsConfig, err := options.tlsConfig()
+	if err != nil { return nil, err }
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.ForceAttemptHTTP2 = true
+
+	var endpointURL string
+	switch options.Protocol {
+	case OTLPProtocolGRPC:
+		// host:port as in the OTel SDKs, the scheme is optional
+		host := strings.TrimPrefix(options.Endpoint, "https://")
+		if strings.HasPrefix(host, "http://") {
+			return nil, fmt.Errorf("OTLP over gRPC requires TLS, use https or the http protocol")
+		}
+		endpointURL = "https://" + strings.TrimSuffix(host, "/") + otlpGRPCPath
+	case OTLPProtocolHTTP:
+		parsed, err := url.Parse(options.Endpoint)
+		if err != nil { return nil, err }
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return nil, fmt.Errorf("invalid OTLP endpoint %q, the http protocol needs an http(s) URL", options.Endpoint)
+		}
+		if parsed.Path == "" || parsed.Path == "/" {
+			parsed.Path = otlpHTTPPath
+		}
+		endpointURL = parsed.String()
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q", options.Protocol)
+	}
+
+	return &OTLPExporter{
+		Options: options,
+		URL: endpointURL,
+		HTTPClient: &http.Client{Transport: transport, Timeout: options.Timeout},
+	}, nil
+}
+
+func (o OTLPOptions) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify}
+	if o.CAFile != "" {
+		ca, err := ioutil.ReadFile(o.CAFile)
+		if err != nil { return nil, err }
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in %s", o.CAFile)
+		}
+	}
+	if o.CertFile != "" {
+		certificate, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil { return nil, err }
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+func (e *OTLPExporter) GetName() string {
+	return e.URL
+}
+
+func (e *OTLPExporter) Push(families []*dto.MetricFamily) error {
+	request := encodeOTLPRequest(families, e.Options.ResourceAttributes, time.Now())
+	return withRetries(e.Options.Retries, e.Options.RetryDelay, func() error {
+		if e.Options.Protocol == OTLPProtocolGRPC {
+			return e.sendGRPC(request)
+		}
+		return e.sendHTTP(request)
+	})
+}
+
+func (e *OTLPExporter) newRequest(body []byte, contentType string) (*http.Request, error) {
+	request, err := http.NewRequest(http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil { return nil, err }
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set("User-Agent", "rmq-console-exporter")
+	for name, value := range e.Options.Headers {
+		request.Header.Set(name, value)
+	}
+	return request, nil
+}
+
+// The codes retryable by the OTLP specification are retried, the others are permanent errors
+func (e *OTLPExporter) sendHTTP(body []byte) error {
+	request, err := e.newRequest(body, "application/x-protobuf")
+	if err != nil { return err }
+	response, err := e.HTTPClient.Do(request)
+	if err != nil { return err }
+	defer response.Body.Close()
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	if response.StatusCode / 100 == 2 {
+		return nil
+	}
+	err = fmt.Errorf("OTLP endpoint returned %s: %s", response.Status, bytes.TrimSpace(message))
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return err
+	}
+	return &permanentError{err}
+}
+
+// Unary gRPC call: the message is prefixed by the compression flag (0) and its length, the status is returned
+// in the grpc-status trailer (or header when there is no response message)
+func (e *OTLPExporter) sendGRPC(message []byte) error {
+	body := make([]byte, 5, 5 + len(message))
+	binary.BigEndian.PutUint32(body[1:], uint32(len(message)))
+	request, err := e.newRequest(append(body, message...), "application/grpc")
+	if err != nil { return err }
+	request.Header.Set("TE", "trailers")
+
+	response, err := e.HTTPClient.Do(request)
+	if err != nil { return err }
+	defer response.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("OTLP endpoint returned %s", response.Status)
+	}
+	status := response.Trailer.Get("Grpc-Status")
+	grpcMessage := response.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status = response.Header.Get("Grpc-Status")
+		grpcMessage = response.Header.Get("Grpc-Message")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil { return fmt.Errorf("invalid grpc-status %q", status) }
+	if code == 0 {
+		return nil
+	}
+	err = fmt.Errorf("OTLP endpoint returned gRPC status %d: %s", code, grpcMessage)
+	// CANCELLED, DEADLINE_EXCEEDED, RESOURCE_EXHAUSTED, ABORTED, OUT_OF_RANGE, UNAVAILABLE and DATA_LOSS
+	switch code {
+	case 1, 4, 8, 10, 11, 14, 15:
+		return err
+	}
+	return &permanentError{err}
+}
+
+// ExportMetricsServiceRequest with one ResourceMetrics and a gauge per metric family:
+// ExportMetricsServiceRequest{1: ResourceMetrics}, ResourceMetrics{1: Resource, 2: ScopeMetrics},
+// Resource{1: KeyValue}, ScopeMetrics{1: InstrumentationScope, 2: Metric},
+// Metric{1: name, 2: description, 5: Gauge}, Gauge{1: NumberDataPoint},
+// NumberDataPoint{7: KeyValue, 3: fixed64 time_unix_nano, 4: double as_double}
+func encodeOTLPRequest(families []*dto.MetricFamily, resourceAttributes map[string]string, timestamp time.Time) []byte {
+	var resource []byte
+	for _, attribute := range sortedKeyValues(resourceAttributes) {
+		resource = appendMessage(resource, 1, attribute)
+	}
+	var scope []byte
+	scope = protowire.AppendTag(scope, 1, protowire.BytesType)
+	scope = protowire.AppendString(scope, otlpScopeName)
+
+	var scopeMetrics []byte
+	scopeMetrics = appendMessage(scopeMetrics, 1, scope)
+	for _, family := range families {
+		var gauge []byte
+		for _, sample := range Samples([]*dto.MetricFamily{family}) {
+			var dataPoint []byte
+			for _, attribute := range sortedKeyValues(sample.Labels) {
+				dataPoint = appendMessage(dataPoint, 7, attribute)
+			}
+			dataPoint = protowire.AppendTag(dataPoint, 3, protowire.Fixed64Type)
+			dataPoint = protowire.AppendFixed64(dataPoint, uint64(timestamp.UnixNano()))
+			dataPoint = protowire.AppendTag(dataPoint, 4, protowire.Fixed64Type)
+			dataPoint = protowire.AppendFixed64(dataPoint, math.Float64bits(sample.Value))
+			gauge = appendMessage(gauge, 1, dataPoint)
+		}
+		var metric []byte
+		metric = protowire.AppendTag(metric, 1, protowire.BytesType)
+		metric = protowire.AppendString(metric, family.GetName())
+		metric = protowire.AppendTag(metric, 2, protowire.BytesType)
+		metric = protowire.AppendString(metric, family.GetHelp())
+		metric = appendMessage(metric, 5, gauge)
+		scopeMetrics = appendMessage(scopeMetrics, 2, metric)
+	}
+
+	var resourceMetrics []byte
+	resourceMetrics = appendMessage(resourceMetrics, 1, resource)
+	resourceMetrics = appendMessage(resourceMetrics, 2, scopeMetrics)
+	return appendMessage(nil, 1, resourceMetrics)
+}
+
+// KeyValue{1: key, 2: AnyValue{1: string_value}} sorted by key
+func sortedKeyValues(attributes map[string]string) [][]byte {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	keyValues := make([][]byte, len(keys))
+	for i, key := range keys {
+		var value []byte
+		value = protowire.AppendTag(value, 1, protowire.BytesType)
+		value = protowire.AppendString(value, attributes[key])
+		var keyValue []byte
+		keyValue = protowire.AppendTag(keyValue, 1, protowire.BytesType)
+		keyValue = protowire.AppendString(keyValue, key)
+		keyValues[i] = appendMessage(keyValue, 2, value)
+	}
+	return keyValues
+}
+
+func appendMessage(buffer []byte, field protowire.Number, message []byte) []byte {
+	buffer = protowire.AppendTag(buffer, field, protowire.BytesType)
+	return protowire.AppendBytes(buffer, message)
+}
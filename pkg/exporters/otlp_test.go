@@ -0,0 +1,147 @@
+package exporters
+
+import (
+	"encoding/binary"
+	"encoding/pem"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Returns the fields of a protobuf message by number, the nested messages are returned as bytes
+func decodeFields(message []byte) map[protowire.Number][][]byte {
+	fields := make(map[protowire.Number][][]byte)
+	for len(message) > 0 {
+		number, wireType, n := protowire.ConsumeTag(message)
+		message = message[n:]
+		var value []byte
+		if wireType == protowire.BytesType {
+			value, n = protowire.ConsumeBytes(message)
+		} else {
+			n = protowire.ConsumeFieldValue(number, wireType, message)
+			value = message[:n]
+		}
+		fields[number] = append(fields[number], value)
+		message = message[n:]
+	}
+	return fields
+}
+
+func testFamilies(t *testing.T) []*dto.MetricFamily {
+	testCollector := new(MockedCollector)
+	testCollector.On("Collect").Return(nil)
+	families, err := buildTestExporter([]ICollector{testCollector}).Gather()
+	assert.Nil(t, err)
+	return families
+}
+
+// Checks the resource attributes and the gauge of the request built from testFamilies
+func checkOTLPRequest(t *testing.T, request []byte) {
+	resourceMetrics := decodeFields(decodeFields(request)[1][0])
+	resource := decodeFields(resourceMetrics[1][0])
+	attribute := decodeFields(resource[1][0])
+	assert.Equal(t, "host.name", string(attribute[1][0]))
+	assert.Equal(t, "host1", string(decodeFields(attribute[2][0])[1][0]))
+
+	scopeMetrics := decodeFields(resourceMetrics[2][0])
+	assert.Equal(t, otlpScopeName, string(decodeFields(scopeMetrics[1][0])[1][0]))
+	metric := decodeFields(scopeMetrics[2][0])
+	assert.Equal(t, "prefix_memory", string(metric[1][0]))
+	dataPoint := decodeFields(decodeFields(metric[5][0])[1][0])
+	assert.Equal(t, 2, len(dataPoint[7]))
+	value, _ := protowire.ConsumeFixed64(dataPoint[4][0])
+	assert.Equal(t, 1.5, math.Float64frombits(value))
+}
+
+func TestOTLPHTTPPush(t *testing.T) {
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/metrics", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("Api-Key"))
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, body)
+	}))
+	defer server.Close()
+
+	exporter, err := NewOTLPExporter(OTLPOptions{
+		Endpoint: server.URL,
+		Protocol: OTLPProtocolHTTP,
+		Headers: map[string]string{"Api-Key": "secret"},
+		ResourceAttributes: map[string]string{"host.name": "host1"},
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, exporter.Push(testFamilies(t)))
+	assert.Equal(t, 1, len(bodies))
+	checkOTLPRequest(t, bodies[0])
+}
+
+func TestOTLPGRPCPush(t *testing.T) {
+	var bodies [][]byte
+	status := "0"
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, 2, r.ProtoMajor)
+		assert.Equal(t, otlpGRPCPath, r.URL.Path)
+		assert.Equal(t, "application/grpc", r.Header.Get("Content-Type"))
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, byte(0), body[0])
+		assert.Equal(t, uint32(len(body) - 5), binary.BigEndian.Uint32(body[1:5]))
+		bodies = append(bodies, body[5:])
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte{0, 0, 0, 0, 0})
+		w.Header().Set("Grpc-Status", status)
+		w.Header().Set("Grpc-Message", "invalid")
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	// The certificate of the test server is trusted with the CA file
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.Nil(t, ioutil.WriteFile(caFile, certificate, 0600))
+
+	exporter, err := NewOTLPExporter(OTLPOptions{
+		Endpoint: server.Listener.Addr().String(),
+		Protocol: OTLPProtocolGRPC,
+		CAFile: caFile,
+		ResourceAttributes: map[string]string{"host.name": "host1"},
+		Retries: 2,
+		RetryDelay: time.Millisecond,
+	})
+	assert.Nil(t, err)
+	assert.Nil(t, exporter.Push(testFamilies(t)))
+	assert.Equal(t, 1, len(bodies))
+	checkOTLPRequest(t, bodies[0])
+
+	// INVALID_ARGUMENT is not retried
+	status = "3"
+	err = exporter.Push(testFamilies(t))
+	assert.Equal(t, "OTLP endpoint returned gRPC status 3: invalid", err.Error())
+	assert.Equal(t, 2, len(bodies))
+}
+
+func TestOTLPInvalidOptions(t *testing.T) {
+	_, err := NewOTLPExporter(OTLPOptions{Endpoint: "http://localhost:4317", Protocol: OTLPProtocolGRPC})
+	assert.NotNil(t, err)
+	_, err = NewOTLPExporter(OTLPOptions{Endpoint: "localhost:4318", Protocol: OTLPProtocolHTTP})
+	assert.NotNil(t, err)
+	_, err = NewOTLPExporter(OTLPOptions{Endpoint: "localhost:4317", Protocol: "thrift"})
+	assert.NotNil(t, err)
+
+	// HTTP by default, gRPC needs TLS
+	exporter, err := NewOTLPExporter(OTLPOptions{Endpoint: "http://localhost:4318"})
+	assert.Nil(t, err)
+	assert.Equal(t, OTLPProtocolHTTP, exporter.Options.Protocol)
+	assert.Equal(t, "http://localhost:4318/v1/metrics", exporter.URL)
+}
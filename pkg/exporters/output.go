@@ -0,0 +1,130 @@
+package exporters
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	OutputProm	= "prom"
+	OutputJSON	= "json"
+	OutputCSV	= "csv"
+)
+
+// One sample of a metric family, used by the outputs that are not the Prometheus text format
+type MetricSample struct {
+	Name	string				`json:"name"`
+	Labels	map[string]string	`json:"labels"`
+	Value	float64				`json:"value"`
+}
+
+// Collects the metrics of the exporter in a new registry, so they are built as in a scrape
+type gatherCollector struct {
+	exporter	*PrometheusExporter
+	errors		[]error
+}
+
+func (c *gatherCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.exporter.Describe(ch)
+}
+
+func (c *gatherCollector) Collect(ch chan<- prometheus.Metric) {
+	c.errors = c.exporter.collectAll(ch)
+}
+
+// Runs all the collectors once without serving HTTP. The metrics of the collectors that succeeded are returned
+// with the error of the first one that failed.
+func (p *PrometheusExporter) Gather() ([]*dto.MetricFamily, error) {
+	collector := &gatherCollector{exporter: p}
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(collector); err != nil { return nil, err }
+	families, err := registry.Gather()
+	if err != nil { return families, err }
+	if len(collector.errors) > 0 {
+		return families, fmt.Errorf("%d collectors failed, first error: %v", len(collector.errors), collector.errors[0])
+	}
+	return families, nil
+}
+
+func WriteMetrics(w io.Writer, families []*dto.MetricFamily, format string) error {
+	switch format {
+	case OutputProm:
+		for _, family := range families {
+			if _, err := expfmt.MetricFamilyToText(w, family); err != nil { return err }
+		}
+		return nil
+	case OutputJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(Samples(families))
+	case OutputCSV:
+		return writeCSV(w, Samples(families))
+	case OutputInflux:
+		return writeInfluxLines(w, Samples(families), time.Now())
+	}
+	return fmt.Errorf("unknown output format %q", format)
+}
+
+// Flattens the metric families, only gauges are built by the exporter
+func Samples(families []*dto.MetricFamily) []MetricSample {
+	samples := []MetricSample{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			var value float64
+			switch {
+			case metric.Gauge != nil:
+				value = metric.GetGauge().GetValue()
+			case metric.Counter != nil:
+				value = metric.GetCounter().GetValue()
+			case metric.Untyped != nil:
+				value = metric.GetUntyped().GetValue()
+			default:
+				continue
+			}
+			samples = append(samples, MetricSample{Name: family.GetName(), Labels: labels, Value: value})
+		}
+	}
+	return samples
+}
+
+// One row per sample with a column for every label name found (metric,<labels>,value), the samples without
+// a label have an empty value in its column
+func writeCSV(w io.Writer, samples []MetricSample) error {
+	labelSet := make(map[string]bool)
+	for _, sample := range samples {
+		for name := range sample.Labels {
+			labelSet[name] = true
+		}
+	}
+	var labelNames []string
+	for name := range labelSet {
+		labelNames = append(labelNames, name)
+	}
+	sort.Strings(labelNames)
+
+	writer := csv.NewWriter(w)
+	header := append(append([]string{"metric"}, labelNames...), "value")
+	if err := writer.Write(header); err != nil { return err }
+	for _, sample := range samples {
+		row := []string{sample.Name}
+		for _, name := range labelNames {
+			row = append(row, sample.Labels[name])
+		}
+		row = append(row, strconv.FormatFloat(sample.Value, 'g', -1, 64))
+		if err := writer.Write(row); err != nil { return err }
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,56 @@
+package exporters
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestExporterGather(t *testing.T) {
+	testCollector := new(MockedCollector)
+	testCollector.On("Collect").Return(nil)
+	exporter := buildTestExporter([]ICollector{testCollector})
+
+	families, err := exporter.Gather()
+	assert.Nil(t, err)
+	assert.Equal(t, []MetricSample{{
+		Name: "prefix_memory",
+		Labels: map[string]string{"queue": "q33", "state": "running"},
+		Value: 1.5,
+	}}, Samples(families))
+
+	var output bytes.Buffer
+	assert.Nil(t, WriteMetrics(&output, families, OutputProm))
+	assert.Contains(t, output.String(), "# TYPE prefix_memory gauge\nprefix_memory{queue=\"q33\",state=\"running\"} 1.5\n")
+
+	output.Reset()
+	assert.Nil(t, WriteMetrics(&output, families, OutputJSON))
+	assert.JSONEq(t, `[{"name":"prefix_memory","labels":{"queue":"q33","state":"running"},"value":1.5}]`, output.String())
+
+	assert.NotNil(t, WriteMetrics(&output, families, "xml"))
+}
+
+func TestExporterGatherFailing(t *testing.T) {
+	testCollector := new(MockedCollector)
+	testCollector.On("Collect").Return(errors.New("some error"))
+	exporter := buildTestExporter([]ICollector{testCollector})
+
+	families, err := exporter.Gather()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "some error")
+	assert.Empty(t, families)
+}
+
+func TestWriteCSV(t *testing.T) {
+	samples := []MetricSample{
+		{Name: "rmq_memory", Labels: map[string]string{"queue": "q,1", "state": "running"}, Value: 1.5},
+		{Name: "rmq_command_runtime_seconds", Labels: map[string]string{"command_executed": "rabbitmqctl list_queues"}, Value: 0.25},
+	}
+	var output bytes.Buffer
+	assert.Nil(t, writeCSV(&output, samples))
+	expected := "metric,command_executed,queue,state,value\n" +
+		"rmq_memory,,\"q,1\",running,1.5\n" +
+		"rmq_command_runtime_seconds,rabbitmqctl list_queues,,,0.25\n"
+	assert.Equal(t, expected, output.String())
+}
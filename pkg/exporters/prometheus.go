@@ -5,9 +5,12 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
-	"github.com/tevino/abool"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
+	"sync"
+	"time"
 )
 
 type IMetrics interface {
@@ -19,15 +22,45 @@ type ICollector interface {
 	Collect() ([]IMetrics, error)
 }
 
+// Collectors implementing this interface can be selected per scrape with the collect[] URL parameter
+type INamedCollector interface {
+	ICollector
+	GetName() string
+}
+
+// Filters that can be overridden per scrape using URL parameters
+type ScrapeFilters struct {
+	QueueRegex	string
+	Vhost		string
+}
+
+func (f ScrapeFilters) IsEmpty() bool {
+	return f.QueueRegex == "" && f.Vhost == ""
+}
+
+type IFilterableCollector interface {
+	ICollector
+	WithFilters(filters ScrapeFilters) (ICollector, error)
+}
+
+// Collectors implementing this interface can collect the metrics from a remote RMQ node using the /probe endpoint
+type ITargetCollector interface {
+	ICollector
+	WithTarget(target string) (ICollector, error)
+}
+
 var (
 	/*
 	 *  Since the collection operation is time very consuming,
-	 *  we will allow only one collector running at any time to avoid multiple errors:
-	 *  - Multiple threads sending the same metric will trigger a duplicated metric error on Prometheus library
-	 *  - Multiple threads hammering the RMQ server for metrics
+	 *  we will allow only one run of the same collector at any time to avoid multiple errors:
+	 *  - Multiple threads hammering the RMQ server for the same metrics
 	 *  - One scrape starting when the previous one hasn't finished yet
+	 *  Different collectors can run at the same time, every scrape uses its own registry so there are no
+	 *  duplicated metrics.
+	 *  The collections are only kept while they are running, the /probe targets come from the scrapes.
 	 */
-	isRunning = abool.New()
+	runningMutex		sync.Mutex
+	runningCollectors	= make(map[collectorLockKey]bool)
 )
 
 type PrometheusExporter struct {
@@ -35,15 +68,44 @@ type PrometheusExporter struct {
 	Port			int
 	RMQCollector	[]ICollector
 	MetricLabels	[]string
+	ProbeDesc		*prometheus.Desc
+	// Last collection of every collector, only updated by the scrapes without filters
+	Snapshots		*SnapshotStore
+	// Evaluated after the collections that update the snapshot
+	Alerts			*AlertEvaluator
+	AlertDesc		*prometheus.Desc
+	target			string
 }
 
+// Labels of the queue metrics, the management API collects all the vhosts at once so its queues have the vhost too
+var (
+	QueueMetricLabels = []string{"queue", "state"}
+	VhostQueueMetricLabels = []string{"queue", "state", "vhost"}
+)
+
 func NewPrometheusExporter(prefix string, port int, collector []ICollector) *PrometheusExporter {
-	labels := []string{"queue", "state"}
+	return NewPrometheusExporterWithLabels(prefix, port, collector, QueueMetricLabels)
+}
+
+func NewPrometheusExporterWithLabels(prefix string, port int, collector []ICollector, labels []string) *PrometheusExporter {
 	return &PrometheusExporter{
 		MetricsDesc: createPrometheusMetrics(prefix, labels),
 		Port: port,
 		RMQCollector: collector,
 		MetricLabels: labels,
+		Snapshots: NewSnapshotStore(),
+		ProbeDesc: prometheus.NewDesc(
+			prefix + "probe_success",
+			"Whether all the collectors succeeded to collect the metrics from the probed target.",
+			nil,
+			nil,
+		),
+		AlertDesc: prometheus.NewDesc(
+			prefix + "alert_active",
+			"Alerts of the rules of the config file firing for a queue, the value is always 1.",
+			[]string{"alert", "queue", "vhost"},
+			nil,
+		),
 	}
 }
 
@@ -51,51 +113,249 @@ func (p *PrometheusExporter) Describe(ch chan<- *prometheus.Desc) {
 	for _, metricDesc := range p.MetricsDesc {
 		ch <- metricDesc
 	}
+	if p.target != "" {
+		ch <- p.ProbeDesc
+	}
+	if p.Alerts != nil {
+		ch <- p.AlertDesc
+	}
 }
 
 func (p *PrometheusExporter) Init() error {
-	prometheus.MustRegister(p)
-	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/metrics", p)
+	http.HandleFunc("/probe", p.ServeProbe)
+	http.HandleFunc("/api/v1/queues", p.ServeQueues)
+	http.HandleFunc("/api/v1/collectors", p.ServeCollectors)
+	http.HandleFunc("/", p.ServeDashboard)
 	return http.ListenAndServe(fmt.Sprintf(":" + strconv.Itoa(p.Port)), nil)
 }
 
-func (p *PrometheusExporter) Collect(ch chan<- prometheus.Metric) {
-	if isRunning.IsSet() {
-		log.Error("A collection is running, skipping new collection...")
+// Every scrape gets its own registry with the collectors selected by the URL parameters:
+// /metrics?collect[]=queues&queue_regex=^orders\..*$&vhost=/
+func (p *PrometheusExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	scrape, err := p.scrapeExporter(r.URL.Query())
+	if err != nil {
+		log.Errorf("Invalid scrape parameters: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	isRunning.Set()
-	defer func() {
-		isRunning.UnSet()
-		log.Info("Metrics collection finished")
-	}()
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(scrape); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+	promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
 
+// Same as /metrics but the collectors run against the target RMQ node, in the style of the blackbox_exporter:
+// /probe?target=rabbit@node2&collect[]=queues
+func (p *PrometheusExporter) ServeProbe(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	target := params.Get("target")
+	if target == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+	scrape, err := p.scrapeExporter(params)
+	if err == nil {
+		scrape, err = scrape.probeExporter(target)
+	}
+	if err != nil {
+		log.Errorf("Invalid probe parameters: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(scrape); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+func (p *PrometheusExporter) scrapeExporter(params url.Values) (*PrometheusExporter, error) {
+	collectors, err := p.selectCollectors(params["collect[]"])
+	if err != nil { return nil, err }
+
+	filters := ScrapeFilters{
+		QueueRegex: params.Get("queue_regex"),
+		Vhost: params.Get("vhost"),
+	}
+	if !filters.IsEmpty() {
+		for i, collector := range collectors {
+			filterable, ok := collector.(IFilterableCollector)
+			if !ok { continue }
+			if collectors[i], err = filterable.WithFilters(filters); err != nil { return nil, err }
+		}
+	}
+	snapshots, alerts := p.Snapshots, p.Alerts
+	if !filters.IsEmpty() {
+		snapshots, alerts = nil, nil
+	}
+
+	return &PrometheusExporter{
+		MetricsDesc: p.MetricsDesc,
+		Port: p.Port,
+		RMQCollector: collectors,
+		MetricLabels: p.MetricLabels,
+		ProbeDesc: p.ProbeDesc,
+		Snapshots: snapshots,
+		Alerts: alerts,
+		AlertDesc: p.AlertDesc,
+	}, nil
+}
+
+// Collectors that can't run against a remote node are not part of the probe
+func (p *PrometheusExporter) probeExporter(target string) (*PrometheusExporter, error) {
+	var collectors []ICollector
+	for _, collector := range p.RMQCollector {
+		targetCollector, ok := collector.(ITargetCollector)
+		if !ok { continue }
+		probeCollector, err := targetCollector.WithTarget(target)
+		if err != nil { return nil, err }
+		collectors = append(collectors, probeCollector)
+	}
+	if len(collectors) == 0 {
+		return nil, fmt.Errorf("no collectors available to probe %q", target)
+	}
+
+	return &PrometheusExporter{
+		MetricsDesc: p.MetricsDesc,
+		Port: p.Port,
+		RMQCollector: collectors,
+		MetricLabels: p.MetricLabels,
+		ProbeDesc: p.ProbeDesc,
+		target: target,
+	}, nil
+}
+
+func (p *PrometheusExporter) selectCollectors(names []string) ([]ICollector, error) {
+	if len(names) == 0 {
+		return append([]ICollector{}, p.RMQCollector...), nil
+	}
+
+	var selected []ICollector
+	for _, name := range names {
+		found := false
+		for _, collector := range p.RMQCollector {
+			if named, ok := collector.(INamedCollector); ok && named.GetName() == name {
+				selected = append(selected, collector)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown collector %q", name)
+		}
+	}
+	return selected, nil
+}
+
+func (p *PrometheusExporter) Collect(ch chan<- prometheus.Metric) {
 	log.Info("Starting metrics collection")
+	defer log.Info("Metrics collection finished")
+
+	errors := p.collectAll(ch)
+	if p.target != "" {
+		probeSuccess := 0.0
+		if len(errors) == 0 { probeSuccess = 1.0 }
+		ch <- prometheus.MustNewConstMetric(p.ProbeDesc, prometheus.GaugeValue, probeSuccess)
+	}
+}
+
+// Runs all the collectors and then evaluates the alerts on the updated snapshot
+func (p *PrometheusExporter) collectAll(ch chan<- prometheus.Metric) []error {
+	var errors []error
 	for _, collector := range p.RMQCollector {
-		var metrics []IMetrics
-		var err error
-		metrics, err = collector.Collect()
-		if err != nil {
-			log.Errorf("Metrics collection has failed for collector %v: %v", collector, err)
-			continue
+		if err := p.collectFrom(collector, ch); err != nil {
+			errors = append(errors, err)
 		}
-		log.Infof("Metrics collected from >> %v << objects. Starting building metrics...", len(metrics))
-		for metricName, pDesc := range p.MetricsDesc {
-			for _, queueMetrics := range metrics {
-				if queueMetricValue, err := queueMetrics.GetMetricValue(metricName); err == nil {
-					metricLabels, err := queueMetrics.GetLabels(metricName)
-					var labels []string
-					if err == nil { labels = p.buildLabels(metricLabels) }
-					constMetric, err := prometheus.NewConstMetric(pDesc, prometheus.GaugeValue, queueMetricValue, labels...)
-					if err != nil {
-						log.Errorf("Error building metric for %s: %v", metricName, err)
-						continue
-					}
-					ch <- constMetric
+	}
+	if p.Alerts == nil || p.Snapshots == nil {
+		return errors
+	}
+
+	if queues, collectedAt := p.Snapshots.Queues(); !collectedAt.IsZero() {
+		p.Alerts.Notify(p.Alerts.Evaluate(queues, time.Now()))
+	}
+	for _, alert := range p.Alerts.Active() {
+		ch <- prometheus.MustNewConstMetric(p.AlertDesc, prometheus.GaugeValue, 1, alert.Alert, alert.Queue, alert.Vhost)
+	}
+	return errors
+}
+
+func (p *PrometheusExporter) collectFrom(collector ICollector, ch chan<- prometheus.Metric) error {
+	key := p.collectorKey(collector)
+	if !startCollection(key) {
+		log.Errorf("A collection is running for collector %v, skipping new collection...", collector)
+		return fmt.Errorf("a collection is already running for collector %v", collector)
+	}
+	defer finishCollection(key)
+
+	start := time.Now()
+	metrics, err := collector.Collect()
+	if p.Snapshots != nil {
+		p.Snapshots.Update(collector, p.metricNames(), metrics, err, start)
+	}
+	if err != nil {
+		log.Errorf("Metrics collection has failed for collector %v: %v", collector, err)
+		return err
+	}
+	log.Infof("Metrics collected from >> %v << objects. Starting building metrics...", len(metrics))
+	for metricName, pDesc := range p.MetricsDesc {
+		for _, queueMetrics := range metrics {
+			if queueMetricValue, err := queueMetrics.GetMetricValue(metricName); err == nil {
+				metricLabels, err := queueMetrics.GetLabels(metricName)
+				var labels []string
+				if err == nil { labels = p.buildLabels(metricLabels) }
+				constMetric, err := prometheus.NewConstMetric(pDesc, prometheus.GaugeValue, queueMetricValue, labels...)
+				if err != nil {
+					log.Errorf("Error building metric for %s: %v", metricName, err)
+					continue
 				}
+				ch <- constMetric
 			}
 		}
 	}
+	return nil
+}
+
+func (p *PrometheusExporter) metricNames() []string {
+	names := make([]string, 0, len(p.MetricsDesc))
+	for name := range p.MetricsDesc {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type collectorLockKey struct {
+	target		string
+	collector	interface{}
+}
+
+func startCollection(key collectorLockKey) bool {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	if runningCollectors[key] {
+		return false
+	}
+	runningCollectors[key] = true
+	return true
+}
+
+func finishCollection(key collectorLockKey) {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	delete(runningCollectors, key)
+}
+
+// Named collectors share the lock with their filtered copies, but not with the copies probing other targets
+func (p *PrometheusExporter) collectorKey(collector ICollector) collectorLockKey {
+	if named, ok := collector.(INamedCollector); ok {
+		return collectorLockKey{p.target, named.GetName()}
+	}
+	return collectorLockKey{p.target, collector}
 }
 
 func (p *PrometheusExporter) buildLabels(labelPairs map[string]string) []string {
@@ -113,73 +373,208 @@ func (p *PrometheusExporter) buildLabels(labelPairs map[string]string) []string
 	return labels
 }
 
-func createPrometheusMetrics(prefix string, labels []string) map[string]*prometheus.Desc {
-	pMetrics := make(map[string]*prometheus.Desc)
+// Metric exported by the agent, the key is the name used by the collectors and the name is exported with the prefix
+type MetricDefinition struct {
+	Key		string
+	Name	string
+	Help	string
+	Labels	[]string
+}
 
-	pMetrics["messages_ready"] = prometheus.NewDesc(
-		prefix + "messages_ready",
-		"Number of messages ready to be delivered to clients.",
-		labels,
-		nil,
-	)
-
-	pMetrics["message_bytes_ready"] = prometheus.NewDesc(
-		prefix + "message_bytes_ready",
-		"Like message_bytes but counting only those messages ready to be delivered to clients.",
-		labels,
-		nil,
-	)
-
-	pMetrics["messages_unacknowledged"] = prometheus.NewDesc(
-		prefix + "messages_unacknowledged",
-		"Like message_bytes but counting only those messages ready to be delivered to clients.",
-		labels,
-		nil,
-	)
-
-	pMetrics["message_bytes_unacknowledged"] = prometheus.NewDesc(
-		prefix + "message_bytes_unacknowledged",
-		"Like message_bytes but counting only those messages delivered to clients but not yet acknowledged.",
-		labels,
-		nil,
-	)
-
-	pMetrics["memory"] = prometheus.NewDesc(
-		prefix + "memory",
-		"Bytes of memory allocated by the runtime for the queue, including stack, heap and internal structures.",
-		labels,
-		nil,
-	)
-
-	pMetrics["consumers"] = prometheus.NewDesc(
-		prefix + "consumers",
-		"Number of consumers.",
-		labels,
-		nil,
-	)
-
-	pMetrics["consumer_utilisation"] = prometheus.NewDesc(
-		prefix + "consumer_utilisation",
-		"Fraction of the time (between 0.0 and 1.0) that the queue is able to immediately deliver messages to " +
-			"consumers. This can be less than 1.0 if consumers are limited by network congestion or prefetch count.",
-		labels,
-		nil,
-	)
-
-	pMetrics["head_message_timestamp"] = prometheus.NewDesc(
-		prefix + "head_message_timestamp",
-		"The timestamp property of the first message in the queue, if present. " +
-			"Timestamps of messages only appear when they are in the paged-in state.",
-		labels,
-		nil,
-	)
-
-	pMetrics["command_runtime"] = prometheus.NewDesc(
-		prefix + "command_runtime_seconds",
-		"Runtime of the command executed to collect the metrics.",
-		[]string{"command_executed"},
-		nil,
-	)
+// The queue metrics have the labels of the exporter (queue and state, plus vhost with the management API)
+func MetricDefinitions(labels []string) []MetricDefinition {
+	return []MetricDefinition{
+		{
+			Key: "messages_ready",
+			Name: "messages_ready",
+			Help: "Number of messages ready to be delivered to clients.",
+			Labels: labels,
+		},
+		{
+			Key: "message_bytes_ready",
+			Name: "message_bytes_ready",
+			Help: "Like message_bytes but counting only those messages ready to be delivered to clients.",
+			Labels: labels,
+		},
+		{
+			Key: "messages_unacknowledged",
+			Name: "messages_unacknowledged",
+			Help: "Like message_bytes but counting only those messages ready to be delivered to clients.",
+			Labels: labels,
+		},
+		{
+			Key: "message_bytes_unacknowledged",
+			Name: "message_bytes_unacknowledged",
+			Help: "Like message_bytes but counting only those messages delivered to clients but not yet acknowledged.",
+			Labels: labels,
+		},
+		{
+			Key: "memory",
+			Name: "memory",
+			Help: "Bytes of memory allocated by the runtime for the queue, including stack, heap and internal structures.",
+			Labels: labels,
+		},
+		{
+			Key: "consumers",
+			Name: "consumers",
+			Help: "Number of consumers.",
+			Labels: labels,
+		},
+		{
+			Key: "consumer_utilisation",
+			Name: "consumer_utilisation",
+			Help: "Fraction of the time (between 0.0 and 1.0) that the queue is able to immediately deliver messages to " +
+				"consumers. This can be less than 1.0 if consumers are limited by network congestion or prefetch count.",
+			Labels: labels,
+		},
+		{
+			Key: "head_message_timestamp",
+			Name: "head_message_timestamp",
+			Help: "The timestamp property of the first message in the queue, if present. " +
+				"Timestamps of messages only appear when they are in the paged-in state.",
+			Labels: labels,
+		},
+		{
+			Key: "command_runtime",
+			Name: "command_runtime_seconds",
+			Help: "Runtime of the command executed to collect the metrics.",
+			Labels: []string{"command_executed"},
+		},
+		{
+			Key: "rabbitmq_version_info",
+			Name: "rabbitmq_version_info",
+			Help: "Version of the RMQ node detected by the auto queue parser, the value is always 1.",
+			Labels: []string{"version"},
+		},
 
+		// Metrics from the management HTTP API
+		{
+			Key: "node_running",
+			Name: "node_running",
+			Help: "Whether the node is running (1) or not (0).",
+			Labels: []string{"node"},
+		},
+		{
+			Key: "node_mem_used",
+			Name: "node_mem_used",
+			Help: "Memory used by the node in bytes.",
+			Labels: []string{"node"},
+		},
+		{
+			Key: "node_mem_limit",
+			Name: "node_mem_limit",
+			Help: "Memory usage high watermark of the node in bytes.",
+			Labels: []string{"node"},
+		},
+		{
+			Key: "node_fd_used",
+			Name: "node_fd_used",
+			Help: "File descriptors used by the node.",
+			Labels: []string{"node"},
+		},
+		{
+			Key: "node_fd_total",
+			Name: "node_fd_total",
+			Help: "File descriptors available to the node.",
+			Labels: []string{"node"},
+		},
+		{
+			Key: "node_sockets_used",
+			Name: "node_sockets_used",
+			Help: "File descriptors used as sockets by the node.",
+			Labels: []string{"node"},
+		},
+		{
+			Key: "node_sockets_total",
+			Name: "node_sockets_total",
+			Help: "File descriptors available for use as sockets by the node.",
+			Labels: []string{"node"},
+		},
+		{
+			Key: "node_proc_used",
+			Name: "node_proc_used",
+			Help: "Erlang processes in use by the node.",
+			Labels: []string{"node"},
+		},
+		{
+			Key: "node_proc_total",
+			Name: "node_proc_total",
+			Help: "Maximum number of Erlang processes of the node.",
+			Labels: []string{"node"},
+		},
+		{
+			Key: "node_disk_free",
+			Name: "node_disk_free",
+			Help: "Disk free space of the node in bytes.",
+			Labels: []string{"node"},
+		},
+		{
+			Key: "node_disk_free_limit",
+			Name: "node_disk_free_limit",
+			Help: "Point at which the disk alarm of the node will go off, in bytes.",
+			Labels: []string{"node"},
+		},
+		{
+			Key: "node_uptime",
+			Name: "node_uptime_milliseconds",
+			Help: "Time since the Erlang VM of the node started, in milliseconds.",
+			Labels: []string{"node"},
+		},
+		{
+			Key: "cluster_queues",
+			Name: "cluster_queues",
+			Help: "Number of queues in the cluster.",
+			Labels: []string{"cluster_name"},
+		},
+		{
+			Key: "cluster_exchanges",
+			Name: "cluster_exchanges",
+			Help: "Number of exchanges in the cluster.",
+			Labels: []string{"cluster_name"},
+		},
+		{
+			Key: "cluster_connections",
+			Name: "cluster_connections",
+			Help: "Number of connections to the cluster.",
+			Labels: []string{"cluster_name"},
+		},
+		{
+			Key: "cluster_channels",
+			Name: "cluster_channels",
+			Help: "Number of channels in the cluster.",
+			Labels: []string{"cluster_name"},
+		},
+		{
+			Key: "cluster_consumers",
+			Name: "cluster_consumers",
+			Help: "Number of consumers in the cluster.",
+			Labels: []string{"cluster_name"},
+		},
+		{
+			Key: "cluster_messages",
+			Name: "cluster_messages",
+			Help: "Sum of ready and unacknowledged messages in all the queues of the cluster.",
+			Labels: []string{"cluster_name"},
+		},
+		{
+			Key: "cluster_messages_ready",
+			Name: "cluster_messages_ready",
+			Help: "Number of messages ready to be delivered to clients in all the queues of the cluster.",
+			Labels: []string{"cluster_name"},
+		},
+		{
+			Key: "cluster_messages_unacknowledged",
+			Name: "cluster_messages_unacknowledged",
+			Help: "Number of messages delivered to clients but not yet acknowledged in all the queues of the cluster.",
+			Labels: []string{"cluster_name"},
+		},
+	}
+}
+
+func createPrometheusMetrics(prefix string, labels []string) map[string]*prometheus.Desc {
+	pMetrics := make(map[string]*prometheus.Desc)
+	for _, metric := range MetricDefinitions(labels) {
+		pMetrics[metric.Key] = prometheus.NewDesc(prefix + metric.Name, metric.Help, metric.Labels, nil)
+	}
 	return pMetrics
-}
\ No newline at end of file
+}
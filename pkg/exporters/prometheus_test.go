@@ -6,6 +6,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -93,6 +96,121 @@ func TestExporterMultipleCollectorsFailing(t *testing.T) {
 	assert.Equal(t, 0, len(ch))
 }
 
+type MockedNamedCollector struct{
+	MockedCollector
+	name	string
+	filters	ScrapeFilters
+}
+
+func (c *MockedNamedCollector) GetName() string {
+	return c.name
+}
+
+func (c *MockedNamedCollector) WithFilters(filters ScrapeFilters) (ICollector, error) {
+	c.filters = filters
+	return c, nil
+}
+
+func TestExporterSelectCollectors(t *testing.T) {
+	queues := &MockedNamedCollector{name: "queues"}
+	node := &MockedNamedCollector{name: "node"}
+	exporter := buildTestExporter([]ICollector{queues, node})
+	node.On("Collect").Return(nil)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/metrics?collect[]=node&queue_regex=^q3.*$&vhost=test", nil)
+	exporter.ServeHTTP(recorder, request)
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, strings.Contains(recorder.Body.String(), `prefix_memory{queue="q33",state="running"} 1.5`))
+	queues.AssertNotCalled(t, "Collect")
+	node.AssertNumberOfCalls(t, "Collect", 1)
+	assert.Equal(t, ScrapeFilters{QueueRegex: "^q3.*$", Vhost: "test"}, node.filters)
+}
+
+func TestExporterSelectUnknownCollector(t *testing.T) {
+	exporter := buildTestExporter([]ICollector{&MockedNamedCollector{name: "queues"}})
+
+	recorder := httptest.NewRecorder()
+	exporter.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics?collect[]=node", nil))
+
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+type MockedTargetCollector struct{
+	MockedCollector
+	target	string
+}
+
+func (c *MockedTargetCollector) WithTarget(target string) (ICollector, error) {
+	c.target = target
+	return c, nil
+}
+
+func TestExporterProbe(t *testing.T) {
+	local := new(MockedCollector)
+	remote := new(MockedTargetCollector)
+	exporter := buildTestExporter([]ICollector{local, remote})
+	remote.On("Collect").Return(nil)
+
+	recorder := httptest.NewRecorder()
+	exporter.ServeProbe(recorder, httptest.NewRequest(http.MethodGet, "/probe?target=rabbit@node2", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, strings.Contains(recorder.Body.String(), `prefix_memory{queue="q33",state="running"} 1.5`))
+	assert.True(t, strings.Contains(recorder.Body.String(), `prefix_probe_success 1`))
+	assert.Equal(t, "rabbit@node2", remote.target)
+	local.AssertNotCalled(t, "Collect")
+
+	// The locks of the targets are released with the collections
+	exporter.ServeProbe(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/probe?target=rabbit@node3", nil))
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+	assert.Empty(t, runningCollectors)
+}
+
+func TestExporterProbeFailing(t *testing.T) {
+	remote := new(MockedTargetCollector)
+	exporter := buildTestExporter([]ICollector{remote})
+	remote.On("Collect").Return(errors.New("some error"))
+
+	recorder := httptest.NewRecorder()
+	exporter.ServeProbe(recorder, httptest.NewRequest(http.MethodGet, "/probe?target=rabbit@node2", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, strings.Contains(recorder.Body.String(), `prefix_probe_success 0`))
+
+	recorder = httptest.NewRecorder()
+	exporter.ServeProbe(recorder, httptest.NewRequest(http.MethodGet, "/probe", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+type VhostTestMetrics struct {
+	TestMetrics
+}
+
+func (m VhostTestMetrics) GetLabels(name string) (map[string]string, error) {
+	labels, err := m.TestMetrics.GetLabels(name)
+	if err == nil { labels["vhost"] = "staging" }
+	return labels, err
+}
+
+type VhostTestCollector struct {}
+
+func (c *VhostTestCollector) Collect() ([]IMetrics, error) {
+	return []IMetrics{&VhostTestMetrics{}}, nil
+}
+
+func TestExporterVhostLabel(t *testing.T) {
+	exporter := NewPrometheusExporterWithLabels("prefix_", 9999, []ICollector{&VhostTestCollector{}}, VhostQueueMetricLabels)
+	recorder := httptest.NewRecorder()
+	exporter.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Contains(t, recorder.Body.String(), `prefix_memory{queue="q33",state="running",vhost="staging"} 1.5`)
+
+	// The queues of the management API keep their vhost in the snapshot
+	queues, _ := exporter.Snapshots.Queues()
+	assert.Equal(t, "staging", queues[0].Vhost)
+}
+
 func buildTestExporter(c []ICollector) *PrometheusExporter {
 	return NewPrometheusExporter("prefix_", 9999, c)
 }
@@ -0,0 +1,83 @@
+package exporters
+
+import (
+	"errors"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// Outputs that receive the metrics after every collection instead of being scraped (textfile, Pushgateway...)
+type IPusher interface {
+	GetName() string
+	Push(families []*dto.MetricFamily) error
+}
+
+// Collects the metrics at every interval and sends them to all the pushers. The metrics are built once per
+// collection with the same descriptions of the /metrics endpoint.
+type PushLoop struct {
+	Exporter	*PrometheusExporter
+	Pushers		[]IPusher
+	Interval	time.Duration
+}
+
+func NewPushLoop(exporter *PrometheusExporter, pushers []IPusher, interval time.Duration) *PushLoop {
+	return &PushLoop{
+		Exporter: exporter,
+		Pushers: pushers,
+		Interval: interval,
+	}
+}
+
+func (l *PushLoop) Run() {
+	ticker := time.NewTicker(l.Interval)
+	defer ticker.Stop()
+	for {
+		_ = l.RunOnce()
+		<-ticker.C
+	}
+}
+
+// Nothing is pushed when a collector fails: the Pushgateway and the textfile replace all the metrics of the
+// previous push, so the series of the failed collector would disappear until the next collection.
+// Returns the error of the collection or the last error of the pushers, all of them are logged.
+func (l *PushLoop) RunOnce() error {
+	families, err := l.Exporter.Gather()
+	if err != nil {
+		log.Errorf("Metrics collection has failed, skipping the push: %v", err)
+		return err
+	}
+
+	var pushErr error
+	for _, pusher := range l.Pushers {
+		if err := pusher.Push(families); err != nil {
+			log.Errorf("Pushing metrics to %s has failed: %v", pusher.GetName(), err)
+			pushErr = err
+			continue
+		}
+		log.Infof("Metrics pushed to %s", pusher.GetName())
+	}
+	return pushErr
+}
+
+// Errors that are not retried by withRetries
+type permanentError struct {
+	err	error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// Retries the function with exponential backoff starting with the delay, unless the error is permanent
+func withRetries(retries int, delay time.Duration, fn func() error) error {
+	err := fn()
+	var permanent *permanentError
+	for retry := 1; retry <= retries && err != nil && !errors.As(err, &permanent); retry++ {
+		log.Warnf("Retrying in %v (%d/%d): %v", delay, retry, retries, err)
+		time.Sleep(delay)
+		delay *= 2
+		err = fn()
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package exporters
+
+import (
+	"errors"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type TestPusher struct {
+	pushed	[][]*dto.MetricFamily
+	err		error
+}
+
+func (p *TestPusher) GetName() string {
+	return "test"
+}
+
+func (p *TestPusher) Push(families []*dto.MetricFamily) error {
+	p.pushed = append(p.pushed, families)
+	return p.err
+}
+
+func TestPushLoopRunOnce(t *testing.T) {
+	testCollectorOk := new(MockedCollector)
+	testCollectorOk.On("Collect").Return(nil)
+	testCollectorFail := &MockedNamedCollector{name: "failing"}
+	testCollectorFail.On("Collect").Return(errors.New("some error"))
+	pusherOk := &TestPusher{}
+	pusherFail := &TestPusher{err: errors.New("push error")}
+	exporter := buildTestExporter([]ICollector{testCollectorOk, testCollectorFail})
+
+	// Nothing is pushed when a collector fails, the outputs keep the previous metrics
+	err := NewPushLoop(exporter, []IPusher{pusherFail, pusherOk}, time.Minute).RunOnce()
+	assert.Contains(t, err.Error(), "some error")
+	assert.Empty(t, pusherOk.pushed)
+	assert.Empty(t, pusherFail.pushed)
+
+	// The metrics are pushed to all the pushers
+	exporter = buildTestExporter([]ICollector{testCollectorOk})
+	err = NewPushLoop(exporter, []IPusher{pusherFail, pusherOk}, time.Minute).RunOnce()
+	assert.Equal(t, "push error", err.Error())
+	assert.Equal(t, 1, len(pusherOk.pushed))
+	assert.Equal(t, 1, len(pusherFail.pushed))
+	assert.Equal(t, "prefix_memory", pusherOk.pushed[0][0].GetName())
+}
+
+func TestPushLoopSingleCollectorFailing(t *testing.T) {
+	testCollector := new(MockedCollector)
+	testCollector.On("Collect").Return(errors.New("a collection is already running"))
+	pusher := &TestPusher{}
+	exporter := buildTestExporter([]ICollector{testCollector})
+
+	// An empty push would wipe the group of the Pushgateway and the textfile
+	assert.NotNil(t, NewPushLoop(exporter, []IPusher{pusher}, time.Minute).RunOnce())
+	assert.Empty(t, pusher.pushed)
+}
+
+func TestWithRetries(t *testing.T) {
+	calls := 0
+	err := withRetries(2, time.Millisecond, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("some error")
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = withRetries(1, time.Millisecond, func() error {
+		calls++
+		return errors.New("some error")
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, 2, calls)
+}
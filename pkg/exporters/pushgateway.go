@@ -0,0 +1,52 @@
+package exporters
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
+	"time"
+)
+
+const defaultPushgatewayJob = "rmq-console-exporter"
+
+// Options of the Pushgateway set in the pushgateway table of the config file
+type PushgatewayOptions struct {
+	URL			string
+	Job			string
+	Grouping	map[string]string
+	Username	string
+	Password	string
+	Retries		int
+	RetryDelay	time.Duration
+}
+
+// Pushes the metrics of every collection to a Pushgateway, for the brokers that Prometheus can't scrape.
+// The metrics of the group are replaced (PUT) so the deleted queues don't stay in the Pushgateway.
+type PushgatewayPusher struct {
+	Options	PushgatewayOptions
+}
+
+func NewPushgatewayPusher(options PushgatewayOptions) *PushgatewayPusher {
+	if options.Job == "" {
+		options.Job = defaultPushgatewayJob
+	}
+	return &PushgatewayPusher{Options: options}
+}
+
+func (p *PushgatewayPusher) GetName() string {
+	return p.Options.URL
+}
+
+func (p *PushgatewayPusher) Push(families []*dto.MetricFamily) error {
+	gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		return families, nil
+	})
+	pusher := push.New(p.Options.URL, p.Options.Job).Gatherer(gatherer)
+	for name, value := range p.Options.Grouping {
+		pusher = pusher.Grouping(name, value)
+	}
+	if p.Options.Username != "" {
+		pusher = pusher.BasicAuth(p.Options.Username, p.Options.Password)
+	}
+	return withRetries(p.Options.Retries, p.Options.RetryDelay, pusher.Push)
+}
@@ -0,0 +1,64 @@
+package exporters
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPushgatewayPush(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	testCollector := new(MockedCollector)
+	testCollector.On("Collect").Return(nil)
+	families, err := buildTestExporter([]ICollector{testCollector}).Gather()
+	assert.Nil(t, err)
+
+	pusher := NewPushgatewayPusher(PushgatewayOptions{
+		URL: server.URL,
+		Grouping: map[string]string{"instance": "rabbit@node1"},
+		Username: "user",
+		Password: "secret",
+		Retries: 2,
+		RetryDelay: time.Millisecond,
+	})
+	assert.Nil(t, pusher.Push(families))
+
+	// The first push fails and it's retried
+	assert.Equal(t, 2, len(requests))
+	request := requests[1]
+	assert.Equal(t, http.MethodPut, request.Method)
+	assert.Equal(t, "/metrics/job/rmq-console-exporter/instance/rabbit@node1", request.URL.Path)
+	username, password, ok := request.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "user", username)
+	assert.Equal(t, "secret", password)
+	assert.Contains(t, bodies[1], "prefix_memory")
+}
+
+func TestPushgatewayPushFailing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	pusher := NewPushgatewayPusher(PushgatewayOptions{URL: server.URL, Job: "rmq", RetryDelay: time.Millisecond})
+	assert.NotNil(t, pusher.Push(nil))
+}
@@ -0,0 +1,155 @@
+package exporters
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const defaultRemoteWriteBatchSize = 10000
+
+// Options of the remote-write endpoint set in the remote_write table of the config file
+type RemoteWriteOptions struct {
+	URL			string
+	Username	string
+	Password	string
+	BearerToken	string
+	Headers		map[string]string
+	BatchSize	int
+	Retries		int
+	RetryDelay	time.Duration
+	Timeout		time.Duration
+}
+
+// Sends the metrics of every collection to a Prometheus remote-write endpoint (Cortex, Mimir, Thanos receive...).
+// The series are split in batches of BatchSize series, every batch is a snappy compressed protobuf WriteRequest.
+type RemoteWriter struct {
+	Options		RemoteWriteOptions
+	HTTPClient	*http.Client
+}
+
+func NewRemoteWriter(options RemoteWriteOptions) *RemoteWriter {
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultRemoteWriteBatchSize
+	}
+	return &RemoteWriter{
+		Options: options,
+		HTTPClient: &http.Client{Timeout: options.Timeout},
+	}
+}
+
+func (w *RemoteWriter) GetName() string {
+	return w.Options.URL
+}
+
+type remoteWriteLabel struct {
+	name	string
+	value	string
+}
+
+type remoteWriteSeries struct {
+	labels	[]remoteWriteLabel
+	value	float64
+}
+
+// All the samples of a collection have the same timestamp
+func (w *RemoteWriter) Push(families []*dto.MetricFamily) error {
+	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+	series := remoteWriteSeriesFrom(Samples(families))
+	for start := 0; start < len(series); start += w.Options.BatchSize {
+		end := start + w.Options.BatchSize
+		if end > len(series) {
+			end = len(series)
+		}
+		request := snappy.Encode(nil, encodeWriteRequest(series[start:end], timestamp))
+		err := withRetries(w.Options.Retries, w.Options.RetryDelay, func() error {
+			return w.send(request)
+		})
+		if err != nil { return fmt.Errorf("batch of series %d-%d failed: %v", start, end, err) }
+	}
+	return nil
+}
+
+// The labels of a series are sorted by name with the metric name in __name__
+func remoteWriteSeriesFrom(samples []MetricSample) []remoteWriteSeries {
+	series := make([]remoteWriteSeries, len(samples))
+	for i, sample := range samples {
+		labels := []remoteWriteLabel{{"__name__", sample.Name}}
+		for name, value := range sample.Labels {
+			labels = append(labels, remoteWriteLabel{name, value})
+		}
+		sort.Slice(labels, func(a, b int) bool { return labels[a].name < labels[b].name })
+		series[i] = remoteWriteSeries{labels: labels, value: sample.Value}
+	}
+	return series
+}
+
+// prometheus.WriteRequest of the remote-write protocol:
+// WriteRequest{1: repeated TimeSeries}, TimeSeries{1: repeated Label, 2: repeated Sample},
+// Label{1: name, 2: value}, Sample{1: double value, 2: int64 timestamp}
+func encodeWriteRequest(series []remoteWriteSeries, timestamp int64) []byte {
+	var request []byte
+	for _, s := range series {
+		var timeSeries []byte
+		for _, label := range s.labels {
+			var encodedLabel []byte
+			encodedLabel = protowire.AppendTag(encodedLabel, 1, protowire.BytesType)
+			encodedLabel = protowire.AppendString(encodedLabel, label.name)
+			encodedLabel = protowire.AppendTag(encodedLabel, 2, protowire.BytesType)
+			encodedLabel = protowire.AppendString(encodedLabel, label.value)
+			timeSeries = protowire.AppendTag(timeSeries, 1, protowire.BytesType)
+			timeSeries = protowire.AppendBytes(timeSeries, encodedLabel)
+		}
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(timestamp))
+		timeSeries = protowire.AppendTag(timeSeries, 2, protowire.BytesType)
+		timeSeries = protowire.AppendBytes(timeSeries, sample)
+
+		request = protowire.AppendTag(request, 1, protowire.BytesType)
+		request = protowire.AppendBytes(request, timeSeries)
+	}
+	return request
+}
+
+// Only the server errors and 429 are retried, the other errors would fail again with the same data
+func (w *RemoteWriter) send(body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, w.Options.URL, bytes.NewReader(body))
+	if err != nil { return err }
+	request.Header.Set("Content-Encoding", "snappy")
+	request.Header.Set("Content-Type", "application/x-protobuf")
+	request.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	request.Header.Set("User-Agent", "rmq-console-exporter")
+	for name, value := range w.Options.Headers {
+		request.Header.Set(name, value)
+	}
+	if w.Options.Username != "" {
+		request.SetBasicAuth(w.Options.Username, w.Options.Password)
+	} else if w.Options.BearerToken != "" {
+		request.Header.Set("Authorization", "Bearer " + w.Options.BearerToken)
+	}
+
+	response, err := w.HTTPClient.Do(request)
+	if err != nil { return err }
+	defer response.Body.Close()
+	if response.StatusCode / 100 == 2 {
+		_, _ = io.Copy(ioutil.Discard, response.Body)
+		return nil
+	}
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	err = fmt.Errorf("remote write returned %s: %s", response.Status, bytes.TrimSpace(message))
+	if response.StatusCode / 100 == 5 || response.StatusCode == http.StatusTooManyRequests {
+		return err
+	}
+	return &permanentError{err}
+}
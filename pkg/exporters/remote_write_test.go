@@ -0,0 +1,123 @@
+package exporters
+
+import (
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Decodes the series of a WriteRequest as their labels plus the value and timestamp of the sample
+func decodeWriteRequest(body []byte) []map[string]string {
+	var series []map[string]string
+	for len(body) > 0 {
+		_, _, n := protowire.ConsumeTag(body)
+		timeSeries, m := protowire.ConsumeBytes(body[n:])
+		body = body[n + m:]
+
+		fields := make(map[string]string)
+		for len(timeSeries) > 0 {
+			field, _, n := protowire.ConsumeTag(timeSeries)
+			message, m := protowire.ConsumeBytes(timeSeries[n:])
+			timeSeries = timeSeries[n + m:]
+			if field == 1 {
+				_, _, n := protowire.ConsumeTag(message)
+				name, m := protowire.ConsumeString(message[n:])
+				_, _, o := protowire.ConsumeTag(message[n + m:])
+				value, _ := protowire.ConsumeString(message[n + m + o:])
+				fields[name] = value
+				continue
+			}
+			_, _, n = protowire.ConsumeTag(message)
+			value, m := protowire.ConsumeFixed64(message[n:])
+			_, _, o := protowire.ConsumeTag(message[n + m:])
+			timestamp, _ := protowire.ConsumeVarint(message[n + m + o:])
+			fields["value"] = strconv.FormatFloat(math.Float64frombits(value), 'g', -1, 64)
+			fields["timestamp"] = strconv.FormatUint(timestamp, 10)
+		}
+		series = append(series, fields)
+	}
+	return series
+}
+
+func TestRemoteWriteSeries(t *testing.T) {
+	series := remoteWriteSeriesFrom([]MetricSample{
+		{Name: "rmq_memory", Labels: map[string]string{"state": "running", "queue": "q1"}, Value: 1.5},
+	})
+	assert.Equal(t, []remoteWriteLabel{{"__name__", "rmq_memory"}, {"queue", "q1"}, {"state", "running"}}, series[0].labels)
+
+	decoded := decodeWriteRequest(encodeWriteRequest(series, 1630920836000))
+	assert.Equal(t, []map[string]string{{
+		"__name__": "rmq_memory",
+		"queue": "q1",
+		"state": "running",
+		"value": "1.5",
+		"timestamp": "1630920836000",
+	}}, decoded)
+}
+
+func TestRemoteWritePush(t *testing.T) {
+	var batches [][]map[string]string
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "tenant1", r.Header.Get("X-Scope-OrgID"))
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		compressed, _ := ioutil.ReadAll(r.Body)
+		body, err := snappy.Decode(nil, compressed)
+		assert.Nil(t, err)
+		batches = append(batches, decodeWriteRequest(body))
+	}))
+	defer server.Close()
+
+	queues := &MockedNamedCollector{name: "queues"}
+	queues.On("Collect").Return(nil)
+	exporter := buildTestExporter([]ICollector{queues})
+	families, err := exporter.Gather()
+	assert.Nil(t, err)
+	families = append(families, families...)
+
+	writer := NewRemoteWriter(RemoteWriteOptions{
+		URL: server.URL,
+		BearerToken: "token",
+		Headers: map[string]string{"X-Scope-OrgID": "tenant1"},
+		BatchSize: 1,
+		Retries: 1,
+		RetryDelay: time.Millisecond,
+	})
+	assert.Nil(t, writer.Push(families))
+	assert.Equal(t, 2, len(batches))
+	assert.Equal(t, "prefix_memory", batches[1][0]["__name__"])
+	assert.Equal(t, "1.5", batches[1][0]["value"])
+}
+
+func TestRemoteWriteNotRetried(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "out of order sample", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	testCollector := new(MockedCollector)
+	testCollector.On("Collect").Return(nil)
+	families, err := buildTestExporter([]ICollector{testCollector}).Gather()
+	assert.Nil(t, err)
+
+	writer := NewRemoteWriter(RemoteWriteOptions{URL: server.URL, Retries: 3, RetryDelay: time.Millisecond})
+	err = writer.Push(families)
+	assert.Contains(t, err.Error(), "out of order sample")
+	assert.Equal(t, 1, requests)
+}
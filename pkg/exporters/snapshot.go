@@ -0,0 +1,129 @@
+package exporters
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultVhost = "/"
+
+// Collectors implementing this interface report the vhost of their queues in the snapshots, the vhost label of the
+// queues (management API) takes precedence
+type IVhostCollector interface {
+	ICollector
+	GetVhost() string
+}
+
+type QueueSnapshot struct {
+	Queue	string				`json:"queue"`
+	Vhost	string				`json:"vhost"`
+	State	string				`json:"state"`
+	Metrics	map[string]float64	`json:"metrics"`
+}
+
+// Result of the last collection of a collector, the queues of the previous successful one are kept when it fails
+type CollectionSnapshot struct {
+	Collector		string			`json:"collector"`
+	LastAttempt		time.Time		`json:"last_attempt"`
+	LastSuccess		time.Time		`json:"last_success,omitempty"`
+	DurationSeconds	float64			`json:"duration_seconds"`
+	Error			string			`json:"error,omitempty"`
+	Queues			[]QueueSnapshot	`json:"-"`
+}
+
+// Keeps in memory the last collection of every collector, updated by the scrapes without filters and the pushes
+type SnapshotStore struct {
+	mutex		sync.RWMutex
+	collections	map[string]*CollectionSnapshot
+}
+
+func NewSnapshotStore() *SnapshotStore {
+	return &SnapshotStore{collections: make(map[string]*CollectionSnapshot)}
+}
+
+func (s *SnapshotStore) Update(collector ICollector, metricNames []string, metrics []IMetrics, err error, start time.Time) {
+	name := collectorName(collector)
+	now := time.Now()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	collection, ok := s.collections[name]
+	if !ok {
+		collection = &CollectionSnapshot{Collector: name}
+		s.collections[name] = collection
+	}
+	collection.LastAttempt = now
+	collection.DurationSeconds = now.Sub(start).Seconds()
+	if err != nil {
+		collection.Error = err.Error()
+		return
+	}
+	collection.Error = ""
+	collection.LastSuccess = now
+	collection.Queues = queueSnapshots(collector, metricNames, metrics)
+}
+
+// Copy of the collections sorted by collector name
+func (s *SnapshotStore) Collections() []CollectionSnapshot {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	collections := make([]CollectionSnapshot, 0, len(s.collections))
+	for _, collection := range s.collections {
+		collections = append(collections, *collection)
+	}
+	sort.Slice(collections, func(i, j int) bool { return collections[i].Collector < collections[j].Collector })
+	return collections
+}
+
+// Queues of all the collectors with the time of the oldest successful collection, zero when nothing has been
+// collected yet
+func (s *SnapshotStore) Queues() ([]QueueSnapshot, time.Time) {
+	var queues []QueueSnapshot
+	var collectedAt time.Time
+	for _, collection := range s.Collections() {
+		if collection.LastSuccess.IsZero() { continue }
+		queues = append(queues, collection.Queues...)
+		if collectedAt.IsZero() || collection.LastSuccess.Before(collectedAt) {
+			collectedAt = collection.LastSuccess
+		}
+	}
+	return queues, collectedAt
+}
+
+// Only the metrics with a queue label are part of the snapshot
+func queueSnapshots(collector ICollector, metricNames []string, metrics []IMetrics) []QueueSnapshot {
+	vhost := defaultVhost
+	if vhostCollector, ok := collector.(IVhostCollector); ok && vhostCollector.GetVhost() != "" {
+		vhost = vhostCollector.GetVhost()
+	}
+	var queues []QueueSnapshot
+	for _, queueMetrics := range metrics {
+		var queue *QueueSnapshot
+		for _, name := range metricNames {
+			value, err := queueMetrics.GetMetricValue(name)
+			if err != nil { continue }
+			labels, err := queueMetrics.GetLabels(name)
+			if err != nil || labels["queue"] == "" { continue }
+			if queue == nil {
+				queue = &QueueSnapshot{Queue: labels["queue"], Vhost: vhost, State: labels["state"], Metrics: make(map[string]float64)}
+				if labels["vhost"] != "" {
+					queue.Vhost = labels["vhost"]
+				}
+			}
+			queue.Metrics[name] = value
+		}
+		if queue != nil {
+			queues = append(queues, *queue)
+		}
+	}
+	return queues
+}
+
+func collectorName(collector ICollector) string {
+	if named, ok := collector.(INamedCollector); ok {
+		return named.GetName()
+	}
+	return fmt.Sprintf("%T", collector)
+}
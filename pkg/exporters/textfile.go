@@ -0,0 +1,47 @@
+package exporters
+
+import (
+	"fmt"
+	dto "github.com/prometheus/client_model/go"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const DefaultTextfileName = "rmq_console_exporter.prom"
+
+// Writes the metrics to a file read by the textfile collector of the node_exporter, instead of exposing them
+// on a port. The file is replaced atomically (temp file + rename) so it's never read half written.
+type TextfileWriter struct {
+	Path	string
+}
+
+func NewTextfileWriter(directory string) *TextfileWriter {
+	return &TextfileWriter{
+		Path: filepath.Join(directory, DefaultTextfileName),
+	}
+}
+
+func (w *TextfileWriter) GetName() string {
+	return w.Path
+}
+
+func (w *TextfileWriter) Push(families []*dto.MetricFamily) error {
+	// The temp file is created in the same directory, rename is only atomic in the same filesystem.
+	// The node_exporter ignores the files without the .prom extension.
+	file, err := ioutil.TempFile(filepath.Dir(w.Path), "." + filepath.Base(w.Path) + ".*.tmp")
+	if err != nil { return fmt.Errorf("creating textfile: %v", err) }
+	defer os.Remove(file.Name())
+
+	if err := WriteMetrics(file, families, OutputProm); err != nil {
+		file.Close()
+		return fmt.Errorf("writing textfile: %v", err)
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil { return err }
+	if err := os.Rename(file.Name(), w.Path); err != nil { return fmt.Errorf("renaming textfile: %v", err) }
+	return nil
+}
@@ -0,0 +1,37 @@
+package exporters
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTextfilePush(t *testing.T) {
+	directory := t.TempDir()
+	testCollector := new(MockedCollector)
+	testCollector.On("Collect").Return(nil)
+	families, err := buildTestExporter([]ICollector{testCollector}).Gather()
+	assert.Nil(t, err)
+	writer := NewTextfileWriter(directory)
+
+	assert.Nil(t, writer.Push(families))
+	content, err := ioutil.ReadFile(filepath.Join(directory, DefaultTextfileName))
+	assert.Nil(t, err)
+	assert.Contains(t, string(content), "prefix_memory{queue=\"q33\",state=\"running\"} 1.5\n")
+
+	info, err := os.Stat(writer.Path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// Only the .prom file is left in the directory
+	files, err := ioutil.ReadDir(directory)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(files))
+}
+
+func TestTextfileMissingDirectory(t *testing.T) {
+	writer := NewTextfileWriter("/nonexistent/textfile")
+	assert.NotNil(t, writer.Push(nil))
+}
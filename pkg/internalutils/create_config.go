@@ -1,15 +1,31 @@
 package internalutils
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"github.com/manifoldco/promptui"
 	"github.com/spf13/viper"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
+	"rmq-console-exporter/pkg/collectors"
 	"strings"
 )
 
+// Options of the config file created without prompts (-create_config -non_interactive)
+type ConfigOptions struct {
+	Path			string
+	QueueRegexps	[]string
+	// Settings of the [exporter] table, by flag name
+	Exporter		map[string]interface{}
+	// The regexps are tested against these queue names, at least one has to be exported
+	SampleQueues	[]string
+	Overwrite		bool
+}
+
 func CreateConfig() error {
 	validatePath := func(filePath string) error {
 		_, err := os.Stat(filePath)
@@ -55,7 +71,7 @@ func CreateConfig() error {
 
 		regex, err := regexPrompt.Run()
 		if err != nil {
-			fmt.Errorf("regexp not valid: %v", err)
+			fmt.Printf("regexp not valid: %v\n", err)
 			continue
 		}
 
@@ -68,9 +84,7 @@ func CreateConfig() error {
 
 	if len(queueRegexps) > 0 {
 		fmt.Println("Writing config file: ", filePath)
-		viper.Set("filters", map[string][]string{})
-		viper.Set("filters.queues", queueRegexps)
-		if err := viper.WriteConfigAs(filePath); err != nil {
+		if err := writeConfig(filePath, ConfigOptions{QueueRegexps: queueRegexps}); err != nil {
 			return err
 		}
 
@@ -86,3 +100,92 @@ func CreateConfig() error {
 
 	return nil
 }
+
+// Creates the config file without prompts for scripts, Ansible or Docker builds. The regexps are validated and tested
+// against the sample queues, and the file is only written when the exporter can load it.
+func CreateConfigFromOptions(options ConfigOptions, out io.Writer) error {
+	if options.Path == "" {
+		return errors.New("the path of the config file is required (-config_file)")
+	}
+	if _, err := os.Stat(options.Path); err == nil && !options.Overwrite {
+		return fmt.Errorf("file %s exists, use -overwrite to replace it", options.Path)
+	}
+	if len(options.QueueRegexps) == 0 {
+		return errors.New("at least one regexp to filter the queues is required (-queue_regex or stdin)")
+	}
+	filter, err := collectors.NewFilter(options.QueueRegexps)
+	if err != nil { return fmt.Errorf("invalid regexp: %v", err) }
+	if len(options.SampleQueues) > 0 {
+		if err := testRegexps(options.QueueRegexps, filter, options.SampleQueues, out); err != nil { return err }
+	}
+
+	// Written next to the file and validated by the exporter before replacing it
+	extension := filepath.Ext(options.Path)
+	tmpPath := filepath.Join(filepath.Dir(options.Path), "." + strings.TrimSuffix(filepath.Base(options.Path), extension) + ".tmp" + extension)
+	if err := writeConfig(tmpPath, options); err != nil { return err }
+	if err := validateConfig(tmpPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	if err := os.Rename(tmpPath, options.Path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	fmt.Fprintf(out, "Config created: %s\n", options.Path)
+	return nil
+}
+
+// Loads the config file like the exporter does
+var validateConfig = func(path string) error {
+	_, err := collectors.NewConfig(path)
+	return err
+}
+
+// Prints which sample queues are exported, a regexp matching none of them is likely a mistake but only fails
+// when no queue is exported at all
+func testRegexps(queueRegexps []string, filter *collectors.Filter, sampleQueues []string, out io.Writer) error {
+	exported := 0
+	for _, queue := range sampleQueues {
+		if filter.Filter(queue) {
+			exported++
+			fmt.Fprintf(out, "exported: %s\n", queue)
+		} else {
+			fmt.Fprintf(out, "filtered: %s\n", queue)
+		}
+	}
+	for _, queueRegexp := range queueRegexps {
+		matched := false
+		compiledRegexp := regexp.MustCompile(queueRegexp)
+		for _, queue := range sampleQueues {
+			if compiledRegexp.MatchString(strings.TrimSpace(queue)) { matched = true; break }
+		}
+		if !matched {
+			fmt.Fprintf(out, "warning: regexp %q matches none of the sample queues\n", queueRegexp)
+		}
+	}
+	if exported == 0 {
+		return fmt.Errorf("none of the %d sample queues is exported by the regexps", len(sampleQueues))
+	}
+	return nil
+}
+
+func writeConfig(filePath string, options ConfigOptions) error {
+	v := viper.New()
+	if len(options.Exporter) > 0 {
+		v.Set(collectors.ExporterTable, options.Exporter)
+	}
+	v.Set("filters.queues", options.QueueRegexps)
+	return v.WriteConfigAs(filePath)
+}
+
+// Non empty lines of the reader, the lines starting with # are comments
+func ReadLines(reader io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") { continue }
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
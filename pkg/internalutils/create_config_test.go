@@ -0,0 +1,112 @@
+package internalutils
+
+import (
+	"bytes"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readConfig(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	return string(content)
+}
+
+func TestCreateConfigFromOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	options := ConfigOptions{
+		Path: path,
+		QueueRegexps: []string{`^orders\.`, "^billing$"},
+		Exporter: map[string]interface{}{"port": 2113, "push_interval": "30s"},
+	}
+	var out bytes.Buffer
+	assert.Nil(t, CreateConfigFromOptions(options, &out))
+	assert.Equal(t, "Config created: " + path + "\n", out.String())
+
+	content := readConfig(t, path)
+	assert.Contains(t, content, "[exporter]")
+	assert.Contains(t, content, "port = 2113")
+	assert.Contains(t, content, `push_interval = "30s"`)
+	assert.Contains(t, content, "[filters]")
+	assert.Contains(t, content, `queues = ["^orders\\.", "^billing$"]`)
+
+	// Without [exporter] when no flag is set
+	options.Exporter = nil
+	options.Overwrite = true
+	assert.Nil(t, CreateConfigFromOptions(options, &out))
+	assert.NotContains(t, readConfig(t, path), "[exporter]")
+}
+
+func TestCreateConfigExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("[filters]\nqueues = ['^old']\n"), 0644))
+	options := ConfigOptions{Path: path, QueueRegexps: []string{"^new"}}
+
+	err := CreateConfigFromOptions(options, ioutil.Discard)
+	assert.EqualError(t, err, "file " + path + " exists, use -overwrite to replace it")
+	assert.Contains(t, readConfig(t, path), "^old")
+
+	options.Overwrite = true
+	assert.Nil(t, CreateConfigFromOptions(options, ioutil.Discard))
+	assert.Contains(t, readConfig(t, path), "^new")
+	assert.NotContains(t, readConfig(t, path), "^old")
+}
+
+func TestCreateConfigInvalidOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	err := CreateConfigFromOptions(ConfigOptions{Path: path, QueueRegexps: []string{"^orders", "("}}, ioutil.Discard)
+	assert.NotNil(t, err)
+	assert.True(t, strings.HasPrefix(err.Error(), "invalid regexp: "))
+
+	assert.NotNil(t, CreateConfigFromOptions(ConfigOptions{Path: path}, ioutil.Discard))
+	assert.NotNil(t, CreateConfigFromOptions(ConfigOptions{QueueRegexps: []string{"^orders"}}, ioutil.Discard))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCreateConfigSampleQueues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	options := ConfigOptions{
+		Path: path,
+		QueueRegexps: []string{`^orders\.`, "^payments"},
+		SampleQueues: []string{"orders.eu", "billing"},
+	}
+	var out bytes.Buffer
+	assert.Nil(t, CreateConfigFromOptions(options, &out))
+	assert.Contains(t, out.String(), "exported: orders.eu\nfiltered: billing\n")
+	assert.Contains(t, out.String(), `warning: regexp "^payments" matches none of the sample queues`)
+
+	// None of the sample queues is exported
+	options.Overwrite = true
+	options.SampleQueues = []string{"billing", "audit"}
+	err := CreateConfigFromOptions(options, ioutil.Discard)
+	assert.EqualError(t, err, "none of the 2 sample queues is exported by the regexps")
+	assert.Contains(t, readConfig(t, path), "^orders")
+}
+
+func TestCreateConfigRemovesTheTempFile(t *testing.T) {
+	dir := t.TempDir()
+	validate := validateConfig
+	defer func() { validateConfig = validate }()
+	validateConfig = func(path string) error {
+		assert.Equal(t, filepath.Join(dir, ".config.tmp.toml"), path)
+		return errors.New("unknown table [filter]")
+	}
+
+	err := CreateConfigFromOptions(ConfigOptions{Path: filepath.Join(dir, "config.toml"), QueueRegexps: []string{"^orders"}}, ioutil.Discard)
+	assert.EqualError(t, err, "invalid config: unknown table [filter]")
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+}
+
+func TestReadLines(t *testing.T) {
+	lines, err := ReadLines(strings.NewReader("^orders\n\n  # comment\n ^billing$ \n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"^orders", "^billing$"}, lines)
+}